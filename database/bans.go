@@ -0,0 +1,44 @@
+package database
+
+import (
+	"database/sql"
+	"log"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// Creates the bans table in the database.
+// it contains the users who are banned from joining each chat, a ban without an expiry date is permanent.
+func CreateBansTable() {
+	const bansTable = `
+	CREATE TABLE IF NOT EXISTS bans (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		chatId TEXT NOT NULL REFERENCES chats(chatId) ON DELETE CASCADE,
+		username TEXT NOT NULL REFERENCES users(username) ON DELETE CASCADE,
+		bannedBy TEXT NOT NULL,
+		reason TEXT NOT NULL DEFAULT '',
+		created_at TEXT NOT NULL DEFAULT(datetime('now')),
+		expires_at TEXT,
+		UNIQUE (chatId, username)
+	);
+	`
+
+	db, err := sql.Open("sqlite3", DatabasePath)
+	defer db.Close()
+
+	if err != nil {
+		log.Fatalln("ERROR: COULD NOT OPEN DATABASE:", err)
+	}
+
+	stmnt, err := db.Prepare(bansTable)
+	defer stmnt.Close()
+	if err != nil {
+		log.Fatalln("ERROR: COULD NOT PREPARE STATMENT:", err)
+	}
+
+	_, err = stmnt.Exec()
+	if err != nil {
+		log.Fatalln("ERROR: COULD NOT CREATE BANS TABLE:", err)
+	}
+	log.Println("Bans table created")
+}
@@ -18,7 +18,9 @@ func CreateChatsTable() {
 		chatName TEXT NOT NULL,
 		password TEXT NOT NULL,
 		created_at TEXT NOT NULL DEFAULT(datetime('now')),
-		owner TEXT NOT NULL DEFAULT 'Dev' REFERENCES users(username) ON DELETE RESTRICT
+		owner TEXT NOT NULL DEFAULT 'Dev' REFERENCES users(username) ON DELETE RESTRICT,
+		kind TEXT NOT NULL DEFAULT 'group',
+		visibility TEXT NOT NULL DEFAULT 'private'
 	);
 	`
 	db, err := sql.Open("sqlite3", DatabasePath)
@@ -48,7 +50,9 @@ func CreateMessageTable() {
 		username TEXT NOT NULL DEFAULT 'Unknown User' REFERENCES users(username) ON DELETE SET DEFAULT,
 		chatId TEXT NOT NULL REFERENCES chats(chatId) ON DELETE CASCADE,
 		content TEXT NOT NULL,
-		date TEXT NOT NULL DEFAULT(datetime('now'))
+		date TEXT NOT NULL DEFAULT(datetime('now')),
+		edited_at TEXT,
+		parentId INTEGER REFERENCES messages(id) ON DELETE SET NULL
 	);
 	`
 	db, err := sql.Open("sqlite3", DatabasePath)
@@ -98,4 +102,12 @@ func CreateTables() {
 	CreateChatsTable()
 	CreateMessageTable()
 	CreateJoinedTable()
+	CreateSessionsTable()
+	CreateReadMarkersTable()
+	CreateBansTable()
+	CreateInvitesTable()
+	CreateMessageEditsTable()
+	CreateReactionsTable()
+	CreatePinsTable()
+	MigrateTables()
 }
@@ -0,0 +1,45 @@
+package database
+
+import (
+	"database/sql"
+	"log"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// Creates the invites table in the database.
+// it contains the invite codes that let users join a chat without its password.
+// an invite without max uses can be used any number of times and an invite without an expiry date never expires.
+func CreateInvitesTable() {
+	const invitesTable = `
+	CREATE TABLE IF NOT EXISTS invites (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		code TEXT UNIQUE NOT NULL,
+		chatId TEXT NOT NULL REFERENCES chats(chatId) ON DELETE CASCADE,
+		createdBy TEXT NOT NULL REFERENCES users(username) ON DELETE CASCADE,
+		max_uses INTEGER,
+		uses INTEGER NOT NULL DEFAULT 0,
+		created_at TEXT NOT NULL DEFAULT(datetime('now')),
+		expires_at TEXT
+	);
+	`
+
+	db, err := sql.Open("sqlite3", DatabasePath)
+	defer db.Close()
+
+	if err != nil {
+		log.Fatalln("ERROR: COULD NOT OPEN DATABASE:", err)
+	}
+
+	stmnt, err := db.Prepare(invitesTable)
+	defer stmnt.Close()
+	if err != nil {
+		log.Fatalln("ERROR: COULD NOT PREPARE STATMENT:", err)
+	}
+
+	_, err = stmnt.Exec()
+	if err != nil {
+		log.Fatalln("ERROR: COULD NOT CREATE INVITES TABLE:", err)
+	}
+	log.Println("Invites table created")
+}
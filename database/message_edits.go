@@ -0,0 +1,40 @@
+package database
+
+import (
+	"database/sql"
+	"log"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// Creates the message_edits table in the database.
+// it contains the previous contents of edited messages, each row is the content a message had before an edit.
+func CreateMessageEditsTable() {
+	const messageEditsTable = `
+	CREATE TABLE IF NOT EXISTS message_edits (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		messageId INTEGER NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+		content TEXT NOT NULL,
+		edited_at TEXT NOT NULL DEFAULT(datetime('now'))
+	);
+	`
+
+	db, err := sql.Open("sqlite3", DatabasePath)
+	defer db.Close()
+
+	if err != nil {
+		log.Fatalln("ERROR: COULD NOT OPEN DATABASE:", err)
+	}
+
+	stmnt, err := db.Prepare(messageEditsTable)
+	defer stmnt.Close()
+	if err != nil {
+		log.Fatalln("ERROR: COULD NOT PREPARE STATMENT:", err)
+	}
+
+	_, err = stmnt.Exec()
+	if err != nil {
+		log.Fatalln("ERROR: COULD NOT CREATE MESSAGE EDITS TABLE:", err)
+	}
+	log.Println("Message edits table created")
+}
@@ -0,0 +1,70 @@
+package database
+
+import (
+	"database/sql"
+	"log"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// Adds a column to a table that was created before the column was added to its CREATE TABLE statement.
+// the definition is the type and constraints of the column, e.g. "TEXT NOT NULL DEFAULT 'member'".
+func addColumnIfMissing(db *sql.DB, table string, column string, definition string) {
+	rows, err := db.Query("SELECT name FROM pragma_table_info(?)", table)
+	if err != nil {
+		log.Fatalln("ERROR: COULD NOT READ COLUMNS OF " + table + ":", err)
+	}
+
+	for rows.Next() {
+		var name string
+		err := rows.Scan(&name)
+		if err != nil {
+			log.Fatalln("ERROR: COULD NOT READ ROW:", err)
+		}
+		if name == column {
+			rows.Close()
+			return
+		}
+	}
+	rows.Close()
+
+	_, err = db.Exec("ALTER TABLE " + table + " ADD COLUMN " + column + " " + definition)
+	if err != nil {
+		log.Fatalln("ERROR: COULD NOT ADD COLUMN " + column + " TO " + table + ":", err)
+	}
+	log.Println("Added column", column, "to", table)
+}
+
+// Updates tables that were created by older versions of the server.
+func MigrateTables() {
+	db, err := sql.Open("sqlite3", DatabasePath)
+	defer db.Close()
+
+	if err != nil {
+		log.Fatalln("ERROR: COULD NOT OPEN DATABASE:", err)
+	}
+
+	addColumnIfMissing(db, "joined", "role", "TEXT NOT NULL DEFAULT 'member'")
+	_, err = db.Exec("UPDATE joined SET role = 'owner' WHERE role != 'owner' and username = (SELECT owner FROM chats WHERE chats.chatId = joined.chatId)")
+	if err != nil {
+		log.Fatalln("ERROR: COULD NOT SET ROLES OF OWNERS:", err)
+	}
+
+	addColumnIfMissing(db, "chats", "kind", "TEXT NOT NULL DEFAULT 'group'")
+	addColumnIfMissing(db, "chats", "visibility", "TEXT NOT NULL DEFAULT 'private'")
+	addColumnIfMissing(db, "messages", "edited_at", "TEXT")
+	addColumnIfMissing(db, "messages", "parentId", "INTEGER REFERENCES messages(id) ON DELETE SET NULL")
+
+	// a reply must be in the same chat as the message it replies to.
+	_, err = db.Exec(`
+	CREATE TRIGGER IF NOT EXISTS messages_parent_same_chat
+	BEFORE INSERT ON messages
+	WHEN NEW.parentId IS NOT NULL and NOT EXISTS (SELECT 1 FROM messages WHERE id = NEW.parentId and chatId = NEW.chatId)
+	BEGIN
+		SELECT RAISE(ABORT, 'the parent message is not in the same chat');
+	END;
+	`)
+	if err != nil {
+		log.Fatalln("ERROR: COULD NOT CREATE TRIGGER messages_parent_same_chat:", err)
+	}
+}
@@ -0,0 +1,41 @@
+package database
+
+import (
+	"database/sql"
+	"log"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// Creates the pins table in the database.
+// it contains the pinned messages of each chat.
+func CreatePinsTable() {
+	const pinsTable = `
+	CREATE TABLE IF NOT EXISTS pins (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		chatId TEXT NOT NULL REFERENCES chats(chatId) ON DELETE CASCADE,
+		messageId INTEGER UNIQUE NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+		pinnedBy TEXT NOT NULL,
+		created_at TEXT NOT NULL DEFAULT(datetime('now'))
+	);
+	`
+
+	db, err := sql.Open("sqlite3", DatabasePath)
+	defer db.Close()
+
+	if err != nil {
+		log.Fatalln("ERROR: COULD NOT OPEN DATABASE:", err)
+	}
+
+	stmnt, err := db.Prepare(pinsTable)
+	defer stmnt.Close()
+	if err != nil {
+		log.Fatalln("ERROR: COULD NOT PREPARE STATMENT:", err)
+	}
+
+	_, err = stmnt.Exec()
+	if err != nil {
+		log.Fatalln("ERROR: COULD NOT CREATE PINS TABLE:", err)
+	}
+	log.Println("Pins table created")
+}
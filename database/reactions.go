@@ -0,0 +1,42 @@
+package database
+
+import (
+	"database/sql"
+	"log"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// Creates the reactions table in the database.
+// it contains the reactions of users to messages, a user can react to a message with each emoji once.
+func CreateReactionsTable() {
+	const reactionsTable = `
+	CREATE TABLE IF NOT EXISTS reactions (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		messageId INTEGER NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+		username TEXT NOT NULL REFERENCES users(username) ON DELETE CASCADE,
+		emoji TEXT NOT NULL,
+		created_at TEXT NOT NULL DEFAULT(datetime('now')),
+		UNIQUE (messageId, username, emoji)
+	);
+	`
+
+	db, err := sql.Open("sqlite3", DatabasePath)
+	defer db.Close()
+
+	if err != nil {
+		log.Fatalln("ERROR: COULD NOT OPEN DATABASE:", err)
+	}
+
+	stmnt, err := db.Prepare(reactionsTable)
+	defer stmnt.Close()
+	if err != nil {
+		log.Fatalln("ERROR: COULD NOT PREPARE STATMENT:", err)
+	}
+
+	_, err = stmnt.Exec()
+	if err != nil {
+		log.Fatalln("ERROR: COULD NOT CREATE REACTIONS TABLE:", err)
+	}
+	log.Println("Reactions table created")
+}
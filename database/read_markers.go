@@ -0,0 +1,41 @@
+package database
+
+import (
+	"database/sql"
+	"log"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// Creates the read_markers table in the database.
+// it contains the id of the last message each user has read in each chat they joined.
+func CreateReadMarkersTable() {
+	const readMarkersTable = `
+	CREATE TABLE IF NOT EXISTS read_markers (
+		username TEXT NOT NULL REFERENCES users(username) ON DELETE CASCADE,
+		chatId TEXT NOT NULL REFERENCES chats(chatId) ON DELETE CASCADE,
+		lastReadId INTEGER NOT NULL DEFAULT 0,
+		updated_at TEXT NOT NULL DEFAULT(datetime('now')),
+		PRIMARY KEY (username, chatId)
+	);
+	`
+
+	db, err := sql.Open("sqlite3", DatabasePath)
+	defer db.Close()
+
+	if err != nil {
+		log.Fatalln("ERROR: COULD NOT OPEN DATABASE:", err)
+	}
+
+	stmnt, err := db.Prepare(readMarkersTable)
+	defer stmnt.Close()
+	if err != nil {
+		log.Fatalln("ERROR: COULD NOT PREPARE STATMENT:", err)
+	}
+
+	_, err = stmnt.Exec()
+	if err != nil {
+		log.Fatalln("ERROR: COULD NOT CREATE READ MARKERS TABLE:", err)
+	}
+	log.Println("Read markers table created")
+}
@@ -0,0 +1,42 @@
+package database
+
+import (
+	"database/sql"
+	"log"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// Creates the sessions table in the database.
+// it contains the sessions that let users resume a login without their password.
+// only the hash of the token of each session is stored.
+func CreateSessionsTable() {
+	const sessionsTable = `
+	CREATE TABLE IF NOT EXISTS sessions (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		tokenHash TEXT UNIQUE NOT NULL,
+		username TEXT NOT NULL REFERENCES users(username) ON DELETE CASCADE,
+		created_at TEXT NOT NULL DEFAULT(datetime('now')),
+		expires_at TEXT NOT NULL
+	);
+	`
+
+	db, err := sql.Open("sqlite3", DatabasePath)
+	defer db.Close()
+
+	if err != nil {
+		log.Fatalln("ERROR: COULD NOT OPEN DATABASE:", err)
+	}
+
+	stmnt, err := db.Prepare(sessionsTable)
+	defer stmnt.Close()
+	if err != nil {
+		log.Fatalln("ERROR: COULD NOT PREPARE STATMENT:", err)
+	}
+
+	_, err = stmnt.Exec()
+	if err != nil {
+		log.Fatalln("ERROR: COULD NOT CREATE SESSIONS TABLE:", err)
+	}
+	log.Println("Sessions table created")
+}
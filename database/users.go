@@ -41,14 +41,16 @@ func CreateUsersTable() {
 }
 
 // Create the logged_in table in the database.
-// it contains data about which chats are each user in.
+// it contains data about which chats are each user in and the role of the user in each chat.
+// the role is one of 'owner', 'admin', 'moderator' or 'member'.
 func CreateJoinedTable() {
 	const loggedInTable = `
 	CREATE TABLE IF NOT EXISTS joined (
 		id INTEGER PRIMARY KEY AUTOINCREMENT,
 		username TEXT NOT NULL REFERENCES users(username) ON DELETE CASCADE,
 		chatId TEXT NOT NULL REFERENCES chats(chatId) ON DELETE CASCADE,
-		joined_at TEXT NOT NULL DEFAULT(datetime('now'))
+		joined_at TEXT NOT NULL DEFAULT(datetime('now')),
+		role TEXT NOT NULL DEFAULT 'member'
 	);
 	`
 
@@ -1,8 +1,12 @@
 package main
 
 import (
+	"crypto/tls"
+	"flag"
 	"log"
+	"math"
 	"net"
+	"strings"
 	"sync"
 
 	"sdig/database"
@@ -10,7 +14,30 @@ import (
 )
 
 func main() {
+	maxFrameSize := flag.Uint("max-frame-size", uint(server.DefaultMaxFrameSize), "the maximum size in bytes of a single request or message frame")
+	tlsCert := flag.String("tls-cert", "", "the certificate file of the server, enables TLS")
+	tlsKey := flag.String("tls-key", "", "the private key file of the certificate")
+	tlsClientCA := flag.String("tls-client-ca", "", "a file of CA certificates, if set clients must send a certificate signed by one of them")
+	tlsSelfSigned := flag.String("tls-self-signed", "", "comma separated hosts to generate a self signed certificate for, enables TLS (for development only)")
+	flag.Parse()
+
+	if *maxFrameSize < uint(server.MinFrameSize) || *maxFrameSize > math.MaxUint32 {
+		log.Fatalln("ERROR: -max-frame-size must be between", server.MinFrameSize, "and", uint32(math.MaxUint32))
+	}
+	server.MaxFrameSize = uint32(*maxFrameSize)
+
+	if *tlsSelfSigned != "" && (*tlsCert != "" || *tlsKey != "") {
+		log.Fatalln("ERROR: -tls-self-signed can't be used with -tls-cert or -tls-key")
+	}
+	if (*tlsCert == "") != (*tlsKey == "") {
+		log.Fatalln("ERROR: -tls-cert and -tls-key must be set together")
+	}
+	if *tlsClientCA != "" && *tlsSelfSigned == "" && *tlsCert == "" {
+		log.Fatalln("ERROR: -tls-client-ca needs -tls-self-signed or -tls-cert and -tls-key")
+	}
+
 	database.CreateTables()
+	server.MigratePlaintextPasswords()
 
 	var mu sync.RWMutex
 	serverManager := server.NewServerManager(&mu)
@@ -22,6 +49,25 @@ func main() {
 		log.Fatalln("ERROR: COULD NOT LISTEN:", err)
 	}
 
+	var tlsConfig *tls.Config
+	if *tlsSelfSigned != "" {
+		hosts := strings.Split(*tlsSelfSigned, ",")
+		for i, host := range hosts {
+			hosts[i] = strings.TrimSpace(host)
+		}
+		tlsConfig, err = server.SelfSignedTLSConfig(hosts, *tlsClientCA)
+	} else if *tlsCert != "" || *tlsKey != "" {
+		tlsConfig, err = server.LoadTLSConfig(*tlsCert, *tlsKey, *tlsClientCA)
+	}
+	if err != nil {
+		log.Fatalln("ERROR: COULD NOT LOAD TLS CONFIG:", err)
+	}
+
+	if tlsConfig != nil {
+		listener = tls.NewListener(listener, tlsConfig)
+		log.Println("Listening with TLS")
+	}
+
 	for {
 		conn, err := listener.Accept()
 		if err != nil {
@@ -0,0 +1,63 @@
+package server
+
+import (
+	"time"
+)
+
+// The duration of a ban that never expires.
+const PermanentBan string = "forever"
+
+// The statement that bans a user from a chat or replaces the ban of the user.
+// it takes the chat id, the username, the username of the banner, the reason and the expiry date (NULL for a permanent ban).
+const banStatement string = `
+	INSERT INTO bans (chatId, username, bannedBy, reason, expires_at) VALUES (?, ?, ?, ?, ?)
+	ON CONFLICT (chatId, username) DO UPDATE SET
+		bannedBy = excluded.bannedBy,
+		reason = excluded.reason,
+		created_at = datetime('now'),
+		expires_at = excluded.expires_at
+`
+
+// The query of the ban of a user in a chat that hasn't expired yet, it takes the chat id and the username.
+const activeBanQuery string = `
+	SELECT bannedBy, reason, COALESCE(expires_at, '') FROM bans
+	WHERE chatId = ? and username = ? and (expires_at IS NULL or expires_at > datetime('now'))
+`
+
+// Parses the duration of a ban or an invite, it is either PermanentBan or a duration such as "30m" or "24h".
+// returns the expiry date, or nil if it never expires.
+func parseExpiry(duration string) (any, error) {
+	if duration == PermanentBan {
+		return nil, nil
+	}
+
+	d, err := time.ParseDuration(duration)
+	if err != nil {
+		return nil, err
+	}
+	if d <= 0 {
+		return nil, badRequest("The duration must be positive")
+	}
+	return time.Now().UTC().Add(d).Format(sqliteDateFormat), nil
+}
+
+// Removal is the data of a MemberKickedEvent or a MemberBannedEvent.
+type Removal struct {
+	Username string		`json:"username"`
+	By string			`json:"by"`
+	Reason string		`json:"reason,omitempty"`
+	ExpiresAt string	`json:"expires_at,omitempty"`	// the expiry date of a ban, empty for kicks and permanent bans.
+}
+
+func (r Removal) String() string {
+	removal := r.Username + " " + r.By
+	if r.ExpiresAt != "" {
+		removal += " " + r.ExpiresAt
+	} else {
+		removal += " -"
+	}
+	if r.Reason != "" {
+		removal += " " + textEscaper.Replace(r.Reason)
+	}
+	return removal
+}
@@ -0,0 +1,54 @@
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseExpiry(t *testing.T) {
+	tests := []struct {
+		duration string
+		want time.Duration	// the expected time until the expiry date, 0 for a ban that never expires.
+		wantErr bool
+	}{
+		{PermanentBan, 0, false},
+		{"30m", 30 * time.Minute, false},
+		{"24h", 24 * time.Hour, false},
+		{"1h30m", 90 * time.Minute, false},
+		{"0s", 0, true},
+		{"-1h", 0, true},
+		{"", 0, true},
+		{"tomorrow", 0, true},
+		{"24", 0, true},
+	}
+	for _, test := range tests {
+		t.Run(test.duration, func(t *testing.T) {
+			before := time.Now().UTC()
+			expiresAt, err := parseExpiry(test.duration)
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("got %v, want an error", expiresAt)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if test.want == 0 {
+				if expiresAt != nil {
+					t.Errorf("got %v, want nil", expiresAt)
+				}
+				return
+			}
+
+			date, err := time.Parse(sqliteDateFormat, expiresAt.(string))
+			if err != nil {
+				t.Fatalf("expiry date %v is not in the sqlite format: %v", expiresAt, err)
+			}
+			want := before.Add(test.want).Truncate(time.Second)
+			if date.Before(want) || date.After(want.Add(2 * time.Second)) {
+				t.Errorf("got %v, want about %v", date, want)
+			}
+		})
+	}
+}
@@ -3,6 +3,8 @@ package server
 import (
 	"database/sql"
 	"log"
+	"math"
+	"strconv"
 	"strings"
 	"sync"
 
@@ -17,20 +19,22 @@ const DatabasePath string = "sdig.db"
 //	chatName: the public name of the chat that is displayed.
 //	chatChan: the channel that receives the requests from users that are logged in to the chat.
 // 	owner: a string of the username of the owner of the chat.
-// 	users: a map of where the key the username and the value is a pointer to the user. note that the users in this map are not all users added to the chat in the database but only the connected to the chat.
+//	public: a bool that represents whether the chat is public.
+// 	users: a map of where the key the username and the value is the set of users logged in to the username from different connections. note that the users in this map are not all users added to the chat in the database but only the connected to the chat. only the goroutine of the chat uses it, the server manager changes it with internal requests.
 //	mu: a pointer to a shared mutex.
 type Chat struct {
 	chatId string				// a unique name for each chat.
 	chatName string 			// the public name of the chat that is displayed.
 	chatChan chan ClientRequest	// the channel that receives the requests from users that are logged in to the chat.
 	owner string				// the username of the owner of the chat.
-	users map[string]*User		// a map of where the key the username and the value is a pointer to the user. Note that the users in this map are not all users added to the chat but only the connected to the chat.
+	public bool					// whether the chat is public, public chats are found by searching and can be joined without a password.
+	users map[string]map[*User]bool	// a map of where the key the username and the value is the set of users logged in to the username. Note that the users in this map are not all users added to the chat but only the connected to the chat. only used by the goroutine of the chat.
 	mu *sync.RWMutex			// a pointer to a shared mutex.
 }
 
-// Loads chats from the database and putting them in map where the key is the chat id and the value is a chat object.
-func LoadChats(mu *sync.RWMutex) map[string]Chat {
-	chats := make(map[string]Chat)
+// Loads chats from the database and putting them in map where the key is the chat id and the value is a pointer to a chat object.
+func LoadChats(mu *sync.RWMutex) map[string]*Chat {
+	chats := make(map[string]*Chat)
 
 	db, err := sql.Open("sqlite3", DatabasePath)
 	if err != nil {
@@ -38,21 +42,21 @@ func LoadChats(mu *sync.RWMutex) map[string]Chat {
 	}
 	defer db.Close()
 
-	rows, err := db.Query("SELECT chatId, chatName, owner FROM chats;")
+	rows, err := db.Query("SELECT chatId, chatName, owner, visibility FROM chats;")
 	if err != nil {
 		log.Fatalln("ERROR: COULD NOT QUERY CHATS:", err)
 	}
 	defer rows.Close()
 
 	for rows.Next() {
-		var chatId, chatName, owner string
+		var chatId, chatName, owner, visibility string
 
-		err := rows.Scan(&chatId, &chatName, &owner)
+		err := rows.Scan(&chatId, &chatName, &owner, &visibility)
 		if err != nil {
 			log.Fatalln("ERROR: COULD NOT READ ROW:", err)
 		}
 		
-		chats[strings.TrimSpace(chatId)] = NewChat(chatId, chatName, owner, mu)
+		chats[strings.TrimSpace(chatId)] = NewChat(chatId, chatName, owner, visibility == VisibilityPublic, mu)
 	}
 	
 	err = rows.Err()
@@ -64,25 +68,46 @@ func LoadChats(mu *sync.RWMutex) map[string]Chat {
 }
 
 // Creates a chat object from the input.
-func NewChat(chatId string, chatName string, owner string, mu *sync.RWMutex) Chat {
-	return Chat {
+func NewChat(chatId string, chatName string, owner string, public bool, mu *sync.RWMutex) *Chat {
+	return &Chat {
 		chatId: chatId,
 		chatName: chatName,
 		chatChan: make(chan ClientRequest),
 		owner: owner,
-		users: make(map[string]*User),
+		public: public,
+		users: make(map[string]map[*User]bool),
 		mu: mu,
 	}
 }
 
+// Adds the user that is logged in to the username to the connected users of the chat.
+func (chat *Chat) connect(username string, user *User) {
+	users, ok := chat.users[username]
+	if !ok {
+		users = make(map[*User]bool)
+		chat.users[username] = users
+	}
+	users[user] = true
+}
+
+// Removes the user that is logged in to the username from the connected users of the chat.
+func (chat *Chat) disconnect(username string, user *User) {
+	users := chat.users[username]
+	delete(users, user)
+	if len(users) == 0 {
+		delete(chat.users, username)
+	}
+}
+
 // Handles requests from users connected to the chat.
 func (chat *Chat) HandleRequests() {
-	db, err := sql.Open("sqlite3", DatabasePath)
+	// foreign keys are enabled for every connection so deleting a message deletes its edits and unsets the parent of its replies.
+	db, err := sql.Open("sqlite3", DatabasePath + "?_foreign_keys=on")
 	if err != nil {
 		log.Panicln("ERROR: COULD OPEN DATABASE:", err)
 	}
 
-	insertMessage, err := db.Prepare("INSERT INTO messages (username, chatId, content) VALUES (?, ?, ?)")
+	insertMessage, err := db.Prepare("INSERT INTO messages (username, chatId, content, parentId) VALUES (?, ?, ?, ?)")
 	if err != nil {
 		log.Panicln("ERROR: COULD PREPARE STATEMENT:", err)
 	}
@@ -94,433 +119,2060 @@ func (chat *Chat) HandleRequests() {
 	}
 	defer getDate.Close()
 
-	for {
-		req := <- chat.chatChan
-		switch (req.string) {
-		case NewMessageRequestType:
-			chat.mu.Lock()
-			res, err := insertMessage.Exec(req.sender.username, chat.chatId, req.content)
-			chat.mu.Unlock()
-			if err != nil {
-				log.Println("Error: Could not insert message", err)
-				req.sender.messages <- NewMessage("e", "An error occured")
-				continue
-			}
-
-			id, err := res.LastInsertId()
-			if err != nil {
-				log.Println("Could not get insertion id")
-				req.sender.messages <- NewMessage("e", "An error occured")
-				continue
-			}
-
-			var date string
-			chat.mu.RLock()
-			err = getDate.QueryRow(id).Scan(&date)
-			chat.mu.RUnlock()
-
-			req.sender.conn.Write([]byte(date))
-			
-			message := []byte(chat.chatId + " " + date + " " + req.content)
-
-			for username, user := range chat.users {
-				if username != req.sender.username {
-					user.conn.Write(message)
-				}
-			}
-
-		case DeleteChatRequestType:
-			for _, user := range chat.users {
-				delete(user.chats, chat.chatId)
-				user.messages <- NewMessage("n", chat.chatId + " got deleted")
-			}
-			return
-
-		case QuitRequestType:
-			delete(chat.users, req.content)
-		}
+	getMessagesRange, err := db.Prepare("SELECT " + messageColumns + " FROM messages WHERE chatId = ? and id >= ? and id <= ? ORDER BY id LIMIT ?")
+	if err != nil {
+		log.Panicln("ERROR: COULD PREPARE STATEMENT:", err)
 	}
-}
-
-
-// The server manager is resposible for many things
-// They are:
-//	1. Load chats.
-//	2. Add new chats.
-//	3. Delete chats.
-//	4. Log users in.
-//	5. Create new users.
-//	6. Delete users.
-//	7. Add users to a chat.
-//	8. Remove users from a chat(leaving or banning).
-// The server manager stores the following:
-//	chats: a map of chat ids to chats.
-//	ManagerChan: the channel through the client sends requests.
-//	mu: a pointer to a shared mutex.
-type ServerManager struct {
-	chats map[string]Chat			// a map of chat ids to chats. should be loaded through LoadChats function.
-	ManagerChan chan ClientRequest	// the channel through the client sends requests.
-	mu *sync.RWMutex				// a pointer to a shared mutex.
-}
+	defer getMessagesRange.Close()
 
-// Creates a server manager. uses LoadChats functions.
-func NewServerManager(mu *sync.RWMutex) ServerManager {
-	return ServerManager{
-		chats: LoadChats(mu),
-		ManagerChan: make(chan ClientRequest, 10),
-		mu: mu,
+	getMessagesBefore, err := db.Prepare("SELECT * FROM (SELECT " + messageColumns + " FROM messages WHERE chatId = ? and id < ? ORDER BY id DESC LIMIT ?) ORDER BY id")
+	if err != nil {
+		log.Panicln("ERROR: COULD PREPARE STATEMENT:", err)
 	}
-}
+	defer getMessagesBefore.Close()
 
-// Start the request handling of each chat.
-func (cm *ServerManager)StartChatsHandleRequests() {
-	for _, chat := range cm.chats {
-		go chat.HandleRequests()
+	getMessage, err := db.Prepare("SELECT " + messageColumns + " FROM messages WHERE id = ? and chatId = ?")
+	if err != nil {
+		log.Panicln("ERROR: COULD PREPARE STATEMENT:", err)
 	}
-}
+	defer getMessage.Close()
 
-// Handles user requests.
-func (cm *ServerManager) HandleRequests() {
-	db, err := sql.Open("sqlite3", "sdig.db")
+	getThread, err := db.Prepare(threadQuery)
 	if err != nil {
-		log.Fatalln("ERROR: FAILED TO OPEN DATABASE:", err)
+		log.Panicln("ERROR: COULD PREPARE STATEMENT:", err)
 	}
-	defer db.Close()
+	defer getThread.Close()
 
-	_, err = db.Exec("PRAGMA foreign_keys = ON;")
+	addReaction, err := db.Prepare(addReactionStatement)
 	if err != nil {
-		log.Fatalln("ERROR: COULD NOT ENABLE foreign_keys:", err)
+		log.Panicln("ERROR: COULD PREPARE STATEMENT:", err)
 	}
+	defer addReaction.Close()
 
-	getChats, err := db.Prepare("SELECT chatId FROM joined WHERE username=?")
+	removeReaction, err := db.Prepare("DELETE FROM reactions WHERE messageId = ? and username = ? and emoji = ?")
 	if err != nil {
-		log.Fatalln("ERROR: FAILED TO PREPARE STATEMENT:", err)
+		log.Panicln("ERROR: COULD PREPARE STATEMENT:", err)
 	}
-	defer getChats.Close()
+	defer removeReaction.Close()
 
-	getUser, err := db.Prepare("SELECT name, password FROM users WHERE username=?")
+	pinMessage, err := db.Prepare(pinStatement)
 	if err != nil {
-		log.Fatalln("ERROR: FAILED TO PREPARE STATEMENT:", err)
+		log.Panicln("ERROR: COULD PREPARE STATEMENT:", err)
 	}
-	defer getUser.Close()
+	defer pinMessage.Close()
 
-	addUser, err := db.Prepare("INSERT INTO users (username, name, password) VALUES (?, ?, ?)")
+	unpinMessage, err := db.Prepare("DELETE FROM pins WHERE messageId = ? and chatId = ?")
 	if err != nil {
-		log.Fatalln("ERROR: FAILED TO PREPARE STATEMENT:", err)
+		log.Panicln("ERROR: COULD PREPARE STATEMENT:", err)
 	}
-	defer addUser.Close()
+	defer unpinMessage.Close()
 
-	deleteUser, err := db.Prepare("DELETE FROM users where username = ? and password = ?")
+	countPins, err := db.Prepare("SELECT COUNT(*) FROM pins WHERE chatId = ?")
 	if err != nil {
-		log.Fatalln("ERROR: FAILED TO PREPARE STATEMENT:", err)
+		log.Panicln("ERROR: COULD PREPARE STATEMENT:", err)
 	}
-	defer deleteUser.Close()
+	defer countPins.Close()
 
-	getChat, err := db.Prepare("SELECT chatName, password FROM chats WHERE chatId = ?")
+	getPinnedMessages, err := db.Prepare(pinnedMessagesQuery)
 	if err != nil {
-		log.Fatalln("ERROR: FAILED TO PREPARE STATEMENT:", err)
+		log.Panicln("ERROR: COULD PREPARE STATEMENT:", err)
 	}
-	defer getChat.Close()
+	defer getPinnedMessages.Close()
 
-	joinChat, err := db.Prepare("INSERT INTO joined (username, chatId) VALUES (?, ?)")
+	getAuthor, err := db.Prepare("SELECT username FROM messages WHERE id = ? and chatId = ?")
 	if err != nil {
-		log.Fatalln("ERROR: FAILED TO PREPARE STATEMENT:", err)
+		log.Panicln("ERROR: COULD PREPARE STATEMENT:", err)
 	}
-	defer joinChat.Close()
+	defer getAuthor.Close()
 
-	leaveChat, err := db.Prepare("DELETE FROM joined WHERE username = ? and chatId = ?")
+	deleteMessage, err := db.Prepare("DELETE FROM messages WHERE id = ? and chatId = ?")
 	if err != nil {
-		log.Fatalln("ERROR: FAILED TO PREPARE STATEMENT:", err)
+		log.Panicln("ERROR: COULD PREPARE STATEMENT:", err)
 	}
-	defer leaveChat.Close()
+	defer deleteMessage.Close()
 
-	addChat, err := db.Prepare("INSERT INTO chats (chatId, chatName, password, owner) VALUES (?, ?, ?, ?)")
+	getRole, err := db.Prepare("SELECT role FROM joined WHERE username = ? and chatId = ?")
 	if err != nil {
-		log.Fatalln("ERROR: FAILED TO PREPARE STATEMENT:", err)
+		log.Panicln("ERROR: COULD PREPARE STATEMENT:", err)
 	}
-	defer addChat.Close()
+	defer getRole.Close()
 
-	getOwner, err := db.Prepare("SELECT owner FROM chats WHERE chatId = ?")
+	markRead, err := db.Prepare(markReadStatement)
 	if err != nil {
-		log.Fatalln("ERROR: FAILED TO PREPARE STATEMENT:", err)
+		log.Panicln("ERROR: COULD PREPARE STATEMENT:", err)
 	}
-	defer getOwner.Close()
+	defer markRead.Close()
 
-	deleteChat, err := db.Prepare("DELETE FROM chats WHERE chatId = ? and password = ?")
+	getMembers, err := db.Prepare("SELECT joined.username, users.name, joined.joined_at, joined.role FROM joined JOIN users ON users.username = joined.username WHERE joined.chatId = ? ORDER BY joined.id")
 	if err != nil {
-		log.Fatalln("ERROR: FAILED TO PREPARE STATEMENT:", err)
+		log.Panicln("ERROR: COULD PREPARE STATEMENT:", err)
 	}
-	defer deleteChat.Close()
-
-	// NOTE: should try adding other ones such as (rename_chat, change_password)
+	defer getMembers.Close()
 
 	for {
-		req := <- cm.ManagerChan
-
-		switch req.string {
-		case LoginRequestType:
-			username, sentPassword, _ := strings.Cut(req.content, " ")
-
-			var password string
-			var nickname string
-
-			username = strings.TrimSpace(username)
-			cm.mu.RLock()
-			err := getUser.QueryRow(username).Scan(&nickname, &password)
-			cm.mu.RUnlock()
-			if err == sql.ErrNoRows {
-				req.sender.messages <- NewMessage("e", "NoSuchUser")
-			} else if err != nil {
-				log.Println("Error: Could not search for user", err)
-				req.sender.messages <- NewMessage("e", "An error occured")
+		req := <- chat.chatChan
+		switch (req.string) {
+		case NewMessageRequestType, ReplyRequestType:
+			if !contentFits(req.requestId, chat.chatId, req.sender.username, req.args[0]) {
+				req.sender.send(req.Error(ErrorCodeMessageTooLarge, "Message is too large"))
+				continue
 			}
 
-			sentPassword = strings.TrimSpace(sentPassword)
-			if password == sentPassword {
-				cm.mu.RLock()
-				rows, err := getChats.Query(strings.TrimSpace(username))
-				cm.mu.RUnlock()
+			var parentId int64
+			var parent any
+			if req.string == ReplyRequestType {
+				var err error
+				parentId, err = strconv.ParseInt(req.args[1], 10, 64)
 				if err != nil {
-					log.Println("Error: Unable to query logged_in table:", err)
-					req.sender.messages <- NewMessage("e", "An error occured")
+					req.sender.send(req.Error(ErrorCodeBadRequest, "Message ID must be a number"))
+					continue
 				}
 
-				for rows.Next() {
-					var chatId string
-
-					err := rows.Scan(&chatId)
-					if err != nil {
-						log.Println("Error: Unable to scan row:", err)
-						req.sender.messages <- NewMessage("e", "An error occured")
-					}
-					req.sender.chats[chatId] = cm.chats[chatId].chatChan
-					cm.chats[chatId].users[username] = req.sender
+				var author string
+				chat.mu.RLock()
+				err = getAuthor.QueryRow(parentId, chat.chatId).Scan(&author)
+				chat.mu.RUnlock()
+				if err == sql.ErrNoRows {
+					req.sender.send(req.Error(ErrorCodeMessageNotFound, "No such message to reply to"))
+					continue
+				} else if err != nil {
+					log.Println("Error: Could not search for message:", err)
+					req.sender.send(req.Error(ErrorCodeInternal, "An error occured"))
+					continue
 				}
-				req.sender.name = nickname
-				req.sender.username = username
-				req.sender.connected = true
-				req.sender.messages <- NewMessage("n", "connected")
+				parent = parentId
 			}
 
-		case NewUserRequestType:
-			parts:= strings.Split(req.content, " ")
-			numParts := len(parts)
-			username := parts[0]
-			name := strings.Join(parts[1:numParts-1], " ")
-			password := parts[numParts-1]
+			chat.mu.Lock()
+			res, err := insertMessage.Exec(req.sender.username, chat.chatId, req.args[0], parent)
+			chat.mu.Unlock()
+			if err != nil {
+				log.Println("Error: Could not insert message", err)
+				req.sender.send(req.Error(ErrorCodeInternal, "An error occured"))
+				continue
+			}
 
-			cm.mu.Lock()
-			_, err = addUser.Exec(username, name, password)
-			cm.mu.Unlock()
+			id, err := res.LastInsertId()
 			if err != nil {
-				if sqliteErr, ok := err.(sqlite3.Error); ok {
-					if sqliteErr.Code == sqlite3.ErrConstraint {
-						req.sender.messages <- NewMessage("n", "Username already taken")
-						continue
-					}
-				}
-				log.Println("Error: Could not add user to users table", err)
-				req.sender.messages <- NewMessage("e", "An error occured")
+				log.Println("Could not get insertion id")
+				req.sender.send(req.Error(ErrorCodeInternal, "An error occured"))
+				continue
 			}
 
-			req.sender.username = username
-			req.sender.name = name
-			req.sender.connected = true
-			req.sender.messages <- NewMessage("n", "User Created and logged in")
+			var date string
+			chat.mu.RLock()
+			err = getDate.QueryRow(id).Scan(&date)
+			chat.mu.RUnlock()
+			if err != nil {
+				log.Println("Error: Could not get message date:", err)
+				req.sender.send(req.Error(ErrorCodeInternal, "An error occured"))
+				continue
+			}
 
-		case DeleteUserRequestType:
-			password := req.content
-			cm.mu.Lock()
-			res, err := deleteUser.Exec(req.sender.username, password)
-			cm.mu.Unlock()
-			if sqliteErr, ok := err.(sqlite3.Error); ok {
-				if sqliteErr.Code == sqlite3.ErrNo(sqlite3.ErrConstraint) {
-					req.sender.messages <- NewMessage("n", "You are the owner of at least one chat, delete or transfer ownership of the chats first.")
-					continue
-				}
-			} else if err != nil {
-				log.Println("Error: Could not delete user:", err)
-				req.sender.messages <- NewMessage("e", "An error occured")
+			stored := StoredMessage{
+				Id: id,
+				ChatId: chat.chatId,
+				Username: req.sender.username,
+				Date: date,
+				Content: req.args[0],
+				ParentId: parentId,
+			}
+			req.sender.send(req.ReplyData("a", date, stored))
+			
+			chat.broadcastOthers(NewDataMessage("m", chat.chatId, stored), req.sender)
+
+		case GetMessagesRequestType:
+			mode := req.args[0]
+			first, err1 := strconv.ParseInt(req.args[1], 10, 64)
+			second, err2 := strconv.ParseInt(req.args[2], 10, 64)
+			if err1 != nil || err2 != nil {
+				req.sender.send(req.Error(ErrorCodeBadRequest, "Message IDs and limit must be numbers"))
 				continue
 			}
 
-			affected, err := res.RowsAffected()
+			var rows *sql.Rows
+			chat.mu.RLock()
+			if mode == MessagesBeforeMode {
+				if first <= 0 {
+					first = math.MaxInt64
+				}
+				rows, err = getMessagesBefore.Query(chat.chatId, first, pageLimit(second))
+			} else {
+				rows, err = getMessagesRange.Query(chat.chatId, first, second, MaxMessagesPage)
+			}
+			chat.mu.RUnlock()
 			if err != nil {
-				log.Println("Error: Could not get affected rows number:", err)
+				log.Println("Error: Could not query messages:", err)
+				req.sender.send(req.Error(ErrorCodeInternal, "An error occured"))
+				continue
 			}
 
-			if affected != 0 {
-				req.sender.username = ""
-				req.sender.chats = make(map[string]chan ClientRequest)
-				req.sender.connected = false
-				req.sender.messages <- NewMessage("n", "User deleted")
+			messages, err := scanMessages(rows, chat.chatId)
+			if err != nil {
+				log.Println("Error: Could not read messages:", err)
+				req.sender.send(req.Error(ErrorCodeInternal, "An error occured"))
+				continue
 			}
-		
-		case JoinChatRequestType:
-			chatId, sentChatPassword, _ := strings.Cut(req.content, " ")
 
-			var chatName string
-			var chatPassword string
+			// a page cut to fit in a frame ends with the id to continue from, the before id in before mode and the from id otherwise.
+			before := mode == MessagesBeforeMode
+			req.sender.send(req.sender.fitPage(messages, before, func(page MessageList, cut bool) Message {
+				content := chat.chatId + " " + strconv.Itoa(len(page))
+				if cut && before {
+					content += " " + strconv.FormatInt(page[0].Id, 10)
+				} else if cut {
+					content += " " + strconv.FormatInt(page[len(page) - 1].Id + 1, 10)
+				}
+				return req.ReplyData("a", content, page)
+			}))
 
-			chatId = strings.TrimSpace(chatId)
-			cm.mu.RLock()
-			err := getChat.QueryRow(chatId).Scan(&chatName, &chatPassword)
-			cm.mu.RUnlock()
+		case DeleteMessageRequestType:
+			messageId, err := strconv.ParseInt(req.args[0], 10, 64)
+			if err != nil {
+				req.sender.send(req.Error(ErrorCodeBadRequest, "Message ID must be a number"))
+				continue
+			}
+
+			var author string
+			chat.mu.RLock()
+			err = getAuthor.QueryRow(messageId, chat.chatId).Scan(&author)
+			chat.mu.RUnlock()
 			if err == sql.ErrNoRows {
-				req.sender.messages <- NewMessage("e", "No Such Chat")
+				req.sender.send(req.Error(ErrorCodeMessageNotFound, "No such message"))
 				continue
 			} else if err != nil {
-				log.Println("Error: Could not search for user", err)
-				req.sender.messages <- NewMessage("e", "An error occured")
+				log.Println("Error: Could not search for message:", err)
+				req.sender.send(req.Error(ErrorCodeInternal, "An error occured"))
 				continue
 			}
 
-			sentChatPassword = strings.TrimSpace(sentChatPassword)
-			if sentChatPassword == chatPassword {
-				cm.mu.Lock()
-				res, err := joinChat.Exec(req.sender.username, chatId)
-				cm.mu.Unlock()
+			if author != req.sender.username {
+				chat.mu.RLock()
+				role, err := getMemberRole(getRole, req.sender.username, chat.chatId)
+				chat.mu.RUnlock()
 				if err != nil {
-					log.Println("Error: Could not join user to chat:", err)
-					req.sender.messages <- NewMessage("e", "An error occured")
+					log.Println("Error: Could not get role:", err)
+					req.sender.send(req.Error(ErrorCodeInternal, "An error occured"))
 					continue
 				}
 
-				affected, err := res.RowsAffected()
-				if err != nil {
-					log.Println("Error: Could not get affected rows number:", err)
-					req.sender.messages <- NewMessage("e", "An error occured")
+				if !CanPerform(role, DeleteMessagePermission) {
+					req.sender.send(req.Error(ErrorCodeNotAllowed, "Only the author or a moderator of the chat can delete the message"))
 					continue
 				}
+			}
 
-				if affected == 0 {
-					req.sender.messages <- NewMessage("n", "Could not join, probably already joined")
-				} else if affected == 1 {
-					req.sender.messages <- NewMessage("n", "Joined " + chatId)
-					req.sender.chats[chatId] = cm.chats[chatId].chatChan
-					cm.chats[chatId].users[req.sender.username] = req.sender
-				}
+			chat.mu.Lock()
+			_, err = deleteMessage.Exec(messageId, chat.chatId)
+			chat.mu.Unlock()
+			if err != nil {
+				log.Println("Error: Could not delete message:", err)
+				req.sender.send(req.Error(ErrorCodeInternal, "An error occured"))
+				continue
 			}
 
-		case LeaveChatRequestType:
-			chatId := req.content
-			
-			var owner string
-			cm.mu.RLock()
-			err := getOwner.QueryRow(chatId).Scan(&owner)
-			cm.mu.RUnlock()
+			req.sender.send(req.Reply("a", "Deleted message " + req.args[0]))
+			chat.broadcast(NewEvent(MessageDeletedEvent, chat.chatId, DeletedMessage{MessageId: messageId, DeletedBy: req.sender.username}))
+
+		case EditMessageRequestType:
+			messageId, err := strconv.ParseInt(req.args[0], 10, 64)
 			if err != nil {
-				log.Println("Error: Could not leave chat:", err)
-				req.sender.messages <- NewMessage("e", "An error occured")
+				req.sender.send(req.Error(ErrorCodeBadRequest, "Message ID must be a number"))
 				continue
 			}
 
-			if owner == req.sender.username {
-				req.sender.messages <- NewMessage("n", "You are the owner of the chat, transfer the ownership of the chat or delete the chat.")
+			if !contentFits(req.requestId, chat.chatId, req.sender.username, req.args[1]) {
+				req.sender.send(req.Error(ErrorCodeMessageTooLarge, "Message is too large"))
 				continue
 			}
 
-			cm.mu.Lock()
-			res, err := leaveChat.Exec(req.sender.username, chatId)
-			cm.mu.Unlock()
+			var author string
+			chat.mu.RLock()
+			err = getAuthor.QueryRow(messageId, chat.chatId).Scan(&author)
+			chat.mu.RUnlock()
+			if err == sql.ErrNoRows {
+				req.sender.send(req.Error(ErrorCodeMessageNotFound, "No such message"))
+				continue
+			} else if err != nil {
+				log.Println("Error: Could not search for message:", err)
+				req.sender.send(req.Error(ErrorCodeInternal, "An error occured"))
+				continue
+			}
+
+			if author != req.sender.username {
+				req.sender.send(req.Error(ErrorCodeNotAllowed, "Only the author of the message can edit it"))
+				continue
+			}
+
+			chat.mu.Lock()
+			editedAt, err := editMessage(db, messageId, chat.chatId, req.args[1])
+			chat.mu.Unlock()
 			if err != nil {
-				log.Println("Error: Could not leave chat:", err)
-				req.sender.messages <- NewMessage("e", "An error occured")
+				log.Println("Error: Could not edit message:", err)
+				req.sender.send(req.Error(ErrorCodeInternal, "An error occured"))
 				continue
 			}
 
-			affected, err := res.RowsAffected()
+			chat.mu.RLock()
+			rows, err := getMessage.Query(messageId, chat.chatId)
+			chat.mu.RUnlock()
 			if err != nil {
-				log.Println("Error: Could not get affected rows number:", err)
-				req.sender.messages <- NewMessage("e", "An error occured")
+				log.Println("Error: Could not query message:", err)
+				req.sender.send(req.Error(ErrorCodeInternal, "An error occured"))
 				continue
 			}
 
-			if affected != 0 {
-				delete(req.sender.chats, chatId)
-				delete(cm.chats[chatId].users, req.sender.username)
-				req.sender.messages <- NewMessage("n", "Left " + chatId)
+			messages, err := scanMessages(rows, chat.chatId)
+			if err != nil || len(messages) == 0 {
+				log.Println("Error: Could not read edited message:", err)
+				req.sender.send(req.Error(ErrorCodeInternal, "An error occured"))
+				continue
 			}
 
-		case NewChatRequestType:
-			parts:= strings.Split(req.content, " ")
-			numParts := len(parts)
-			chatId := parts[0]
-			chatName := strings.Join(parts[1:numParts-1], " ")
-			password := parts[numParts-1]
+			edited := messages[0]
+			edited.EditedAt = editedAt
+			req.sender.send(req.ReplyData("a", "Edited message " + req.args[0], edited))
+			chat.broadcastOthers(NewEvent(MessageEditedEvent, chat.chatId, edited), req.sender)
 
-			cm.mu.Lock()
-			_, err = addChat.Exec(chatId, chatName, password, req.sender.username)
-			cm.mu.Unlock()
-			if sqliteErr, ok := err.(sqlite3.Error); ok {
-				if sqliteErr.Code == sqlite3.ErrConstraint {
-					req.sender.messages <- NewMessage("n", "ChatId already taken")
-					break
+		case AddReactionRequestType, RemoveReactionRequestType:
+			messageId, err := strconv.ParseInt(req.args[0], 10, 64)
+			if err != nil {
+				req.sender.send(req.Error(ErrorCodeBadRequest, "Message ID must be a number"))
+				continue
+			}
+			emoji := req.args[1]
+
+			var author string
+			chat.mu.RLock()
+			err = getAuthor.QueryRow(messageId, chat.chatId).Scan(&author)
+			chat.mu.RUnlock()
+			if err == sql.ErrNoRows {
+				req.sender.send(req.Error(ErrorCodeMessageNotFound, "No such message"))
+				continue
+			} else if err != nil {
+				log.Println("Error: Could not search for message:", err)
+				req.sender.send(req.Error(ErrorCodeInternal, "An error occured"))
+				continue
+			}
+
+			var res sql.Result
+			event, reply := ReactionAddedEvent, "Reacted to message "
+			chat.mu.Lock()
+			if req.string == AddReactionRequestType {
+				res, err = addReaction.Exec(messageId, req.sender.username, emoji)
+			} else {
+				res, err = removeReaction.Exec(messageId, req.sender.username, emoji)
+				event, reply = ReactionRemovedEvent, "Removed reaction to message "
+			}
+			chat.mu.Unlock()
+			if err != nil {
+				log.Println("Error: Could not change reaction:", err)
+				req.sender.send(req.Error(ErrorCodeInternal, "An error occured"))
+				continue
+			}
+
+			affected, err := res.RowsAffected()
+			if err != nil {
+				log.Println("Error: Could not get affected rows number:", err)
+				req.sender.send(req.Error(ErrorCodeInternal, "An error occured"))
+				continue
+			}
+
+			reaction := Reaction{MessageId: messageId, Username: req.sender.username, Emoji: emoji}
+			req.sender.send(req.ReplyData("a", reply + req.args[0], reaction))
+			if affected == 0 {
+				continue
+			}
+			chat.broadcastOthers(NewEvent(event, chat.chatId, reaction), req.sender)
+
+		case PinMessageRequestType, UnpinMessageRequestType:
+			messageId, err := strconv.ParseInt(req.args[0], 10, 64)
+			if err != nil {
+				req.sender.send(req.Error(ErrorCodeBadRequest, "Message ID must be a number"))
+				continue
+			}
+
+			chat.mu.RLock()
+			role, err := getMemberRole(getRole, req.sender.username, chat.chatId)
+			chat.mu.RUnlock()
+			if err != nil {
+				log.Println("Error: Could not get role:", err)
+				req.sender.send(req.Error(ErrorCodeInternal, "An error occured"))
+				continue
+			}
+
+			if !CanPerform(role, PinPermission) {
+				req.sender.send(req.Error(ErrorCodeNotAllowed, "Only admins of the chat can pin and unpin messages"))
+				continue
+			}
+
+			var author string
+			chat.mu.RLock()
+			err = getAuthor.QueryRow(messageId, chat.chatId).Scan(&author)
+			chat.mu.RUnlock()
+			if err == sql.ErrNoRows {
+				req.sender.send(req.Error(ErrorCodeMessageNotFound, "No such message"))
+				continue
+			} else if err != nil {
+				log.Println("Error: Could not search for message:", err)
+				req.sender.send(req.Error(ErrorCodeInternal, "An error occured"))
+				continue
+			}
+
+			var res sql.Result
+			event, reply := MessagePinnedEvent, "Pinned message "
+			if req.string == PinMessageRequestType {
+				var pins int64
+				chat.mu.RLock()
+				err = countPins.QueryRow(chat.chatId).Scan(&pins)
+				chat.mu.RUnlock()
+				if err != nil {
+					log.Println("Error: Could not count pins:", err)
+					req.sender.send(req.Error(ErrorCodeInternal, "An error occured"))
+					continue
+				}
+
+				if pins >= MaxPinsPerChat {
+					req.sender.send(req.Error(ErrorCodePinLimit, "A chat can't have more than " + strconv.FormatInt(MaxPinsPerChat, 10) + " pinned messages"))
+					continue
+				}
+
+				chat.mu.Lock()
+				res, err = pinMessage.Exec(chat.chatId, messageId, req.sender.username)
+				chat.mu.Unlock()
+			} else {
+				chat.mu.Lock()
+				res, err = unpinMessage.Exec(messageId, chat.chatId)
+				chat.mu.Unlock()
+				event, reply = MessageUnpinnedEvent, "Unpinned message "
+			}
+			if err != nil {
+				log.Println("Error: Could not change pin:", err)
+				req.sender.send(req.Error(ErrorCodeInternal, "An error occured"))
+				continue
+			}
+
+			affected, err := res.RowsAffected()
+			if err != nil {
+				log.Println("Error: Could not get affected rows number:", err)
+				req.sender.send(req.Error(ErrorCodeInternal, "An error occured"))
+				continue
+			}
+
+			pin := Pin{MessageId: messageId, By: req.sender.username}
+			req.sender.send(req.ReplyData("a", reply + req.args[0], pin))
+			if affected == 0 {
+				continue
+			}
+			chat.broadcastOthers(NewEvent(event, chat.chatId, pin), req.sender)
+
+		case GetPinsRequestType:
+			afterId, err := strconv.ParseInt(req.args[0], 10, 64)
+			if err != nil {
+				req.sender.send(req.Error(ErrorCodeBadRequest, "Message ID must be a number"))
+				continue
+			}
+
+			chat.mu.RLock()
+			rows, err := getPinnedMessages.Query(chat.chatId, chat.chatId, afterId)
+			chat.mu.RUnlock()
+			if err != nil {
+				log.Println("Error: Could not query pinned messages:", err)
+				req.sender.send(req.Error(ErrorCodeInternal, "An error occured"))
+				continue
+			}
+
+			messages, err := scanMessages(rows, chat.chatId)
+			if err != nil {
+				log.Println("Error: Could not read messages:", err)
+				req.sender.send(req.Error(ErrorCodeInternal, "An error occured"))
+				continue
+			}
+			req.sender.send(req.sender.fitPage(messages, false, afterIdPage(req, chat.chatId)))
+
+		case GetThreadRequestType:
+			rootId, err1 := strconv.ParseInt(req.args[0], 10, 64)
+			afterId, err2 := strconv.ParseInt(req.args[1], 10, 64)
+			if err1 != nil || err2 != nil {
+				req.sender.send(req.Error(ErrorCodeBadRequest, "Message ID must be a number"))
+				continue
+			}
+
+			chat.mu.RLock()
+			rows, err := getThread.Query(rootId, chat.chatId, afterId, MaxMessagesPage)
+			chat.mu.RUnlock()
+			if err != nil {
+				log.Println("Error: Could not query thread:", err)
+				req.sender.send(req.Error(ErrorCodeInternal, "An error occured"))
+				continue
+			}
+
+			messages, err := scanMessages(rows, chat.chatId)
+			if err != nil {
+				log.Println("Error: Could not read messages:", err)
+				req.sender.send(req.Error(ErrorCodeInternal, "An error occured"))
+				continue
+			}
+
+			if len(messages) == 0 && afterId == 0 {
+				req.sender.send(req.Error(ErrorCodeMessageNotFound, "No such message"))
+				continue
+			}
+			req.sender.send(req.sender.fitPage(messages, false, afterIdPage(req, chat.chatId)))
+
+		case MarkReadRequestType:
+			messageId, err := strconv.ParseInt(req.args[0], 10, 64)
+			if err != nil {
+				req.sender.send(req.Error(ErrorCodeBadRequest, "Message ID must be a number"))
+				continue
+			}
+
+			var author string
+			chat.mu.RLock()
+			err = getAuthor.QueryRow(messageId, chat.chatId).Scan(&author)
+			chat.mu.RUnlock()
+			if err == sql.ErrNoRows {
+				req.sender.send(req.Error(ErrorCodeMessageNotFound, "No such message"))
+				continue
+			} else if err != nil {
+				log.Println("Error: Could not search for message:", err)
+				req.sender.send(req.Error(ErrorCodeInternal, "An error occured"))
+				continue
+			}
+
+			chat.mu.Lock()
+			res, err := markRead.Exec(req.sender.username, chat.chatId, messageId)
+			chat.mu.Unlock()
+			if err != nil {
+				log.Println("Error: Could not mark message as read:", err)
+				req.sender.send(req.Error(ErrorCodeInternal, "An error occured"))
+				continue
+			}
+
+			affected, err := res.RowsAffected()
+			if err != nil {
+				log.Println("Error: Could not get affected rows number:", err)
+				req.sender.send(req.Error(ErrorCodeInternal, "An error occured"))
+				continue
+			}
+
+			req.sender.send(req.Reply("a", "Read " + chat.chatId + " " + req.args[0]))
+			if affected == 0 {
+				continue
+			}
+			chat.broadcastOthers(NewEvent(MessageReadEvent, chat.chatId, ReadReceipt{Username: req.sender.username, MessageId: messageId}), req.sender)
+
+		case GetUsersRequestType:
+			chat.mu.RLock()
+			rows, err := getMembers.Query(chat.chatId)
+			chat.mu.RUnlock()
+			if err != nil {
+				log.Println("Error: Could not query members:", err)
+				req.sender.send(req.Error(ErrorCodeInternal, "An error occured"))
+				continue
+			}
+
+			members, err := chat.scanMembers(rows)
+			if err != nil {
+				log.Println("Error: Could not read members:", err)
+				req.sender.send(req.Error(ErrorCodeInternal, "An error occured"))
+				continue
+			}
+			req.sender.send(req.ReplyData("a", chat.chatId + " " + strconv.Itoa(len(members)), members))
+
+		case DeleteChatRequestType:
+			for _, users := range chat.users {
+				for user := range users {
+					user.removeChat(chat.chatId)
+					user.send(NewMessage("n", chat.chatId + " got deleted"))
+				}
+			}
+			return
+
+		case QuitRequestType, LogoutRequestType:
+			chat.disconnect(req.args[0], req.sender)
+
+		case ConnectRequestType:
+			chat.connect(req.args[0], req.sender)
+
+		case DisconnectRequestType:
+			users := chat.users[req.args[0]]
+			delete(chat.users, req.args[0])
+			for user := range users {
+				user.removeChat(chat.chatId)
+			}
+			if req.message.string == "" {
+				continue
+			}
+			for user := range users {
+				user.send(req.message)
+			}
+			chat.broadcast(req.message)
+
+		case BroadcastRequestType:
+			chat.broadcastOthers(req.message, req.sender)
+
+		default:
+			req.sender.send(req.Error(ErrorCodeUnknownRequest, "Unknown request " + req.string))
+		}
+	}
+}
+
+
+// The server manager is resposible for many things
+// They are:
+//	1. Load chats.
+//	2. Add new chats.
+//	3. Delete chats.
+//	4. Log users in.
+//	5. Create new users.
+//	6. Delete users.
+//	7. Add users to a chat.
+//	8. Remove users from a chat(leaving or banning).
+//	9. Create, resume and revoke sessions.
+//	10. Change the roles of members of a chat.
+//	11. Kick, ban and unban users from a chat.
+//	12. Transfer the ownership of a chat.
+//	13. Rename chats and change their passwords.
+//	14. Change the nicknames and passwords of users.
+//	15. Create direct chats between two users.
+//	16. Create, redeem and revoke invites to chats.
+//	17. Make chats public or private and search for public chats.
+// The server manager stores the following:
+//	chats: a map of chat ids to chats.
+//	online: a map of usernames to the users that are logged in to them, a username can be logged in from many connections.
+//	ManagerChan: the channel through the client sends requests.
+//	mu: a pointer to a shared mutex.
+type ServerManager struct {
+	chats map[string]*Chat			// a map of chat ids to chats. should be loaded through LoadChats function.
+	online map[string]map[*User]bool	// a map of usernames to the set of users that are logged in to them, only accessed by the server manager.
+	ManagerChan chan ClientRequest	// the channel through the client sends requests.
+	mu *sync.RWMutex				// a pointer to a shared mutex.
+}
+
+// Creates a server manager. uses LoadChats functions.
+func NewServerManager(mu *sync.RWMutex) ServerManager {
+	return ServerManager{
+		chats: LoadChats(mu),
+		online: make(map[string]map[*User]bool),
+		ManagerChan: make(chan ClientRequest, 10),
+		mu: mu,
+	}
+}
+
+// Start the request handling of each chat.
+func (cm *ServerManager)StartChatsHandleRequests() {
+	for _, chat := range cm.chats {
+		go chat.HandleRequests()
+	}
+}
+
+// Logs the user in to the username and connects it to the chats the username has joined.
+// getChats is the statement that selects the ids of the chats a username has joined.
+func (cm *ServerManager) connectUser(user *User, username string, nickname string, getChats *sql.Stmt) error {
+	cm.mu.RLock()
+	rows, err := getChats.Query(username)
+	cm.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var chatId string
+
+		err := rows.Scan(&chatId)
+		if err != nil {
+			return err
+		}
+		cm.connectToChat(user, username, cm.chats[chatId])
+	}
+
+	user.name = nickname
+	user.username = username
+	user.connected = true
+	return rows.Err()
+}
+
+// Connects the user to the chat.
+// the goroutine of the chat adds the user to its connected users before the chat is added to the chats of the user.
+func (cm *ServerManager) connectToChat(user *User, username string, chat *Chat) {
+	chat.chatChan <- ConnectRequest(username, user)
+	user.addChat(chat.chatId, chat.chatChan)
+}
+
+// Connects every user that is logged in to the username to the chat.
+func (cm *ServerManager) connectOnline(username string, chat *Chat) {
+	for user := range cm.online[username] {
+		cm.connectToChat(user, username, chat)
+	}
+}
+
+// Disconnects every user logged in to the username from the chat through the goroutine of the chat.
+// the message is sent to the user and to the rest of the chat, unless it is empty.
+func (cm *ServerManager) disconnectFromChat(chatId string, username string, message Message) {
+	chat, ok := cm.chats[chatId]
+	if !ok {
+		return
+	}
+	chat.chatChan <- DisconnectRequest(username, message)
+}
+
+// Sends the message to the users connected to the chat through the goroutine of the chat, except the sender if it isn't nil.
+func (cm *ServerManager) broadcast(chatId string, message Message, sender *User) {
+	chat, ok := cm.chats[chatId]
+	if !ok {
+		return
+	}
+	chat.chatChan <- BroadcastRequest(message, sender)
+}
+
+// Adds the user to the online users of the username it is logged in to.
+func (cm *ServerManager) goOnline(user *User) {
+	users, ok := cm.online[user.username]
+	if !ok {
+		users = make(map[*User]bool)
+		cm.online[user.username] = users
+	}
+	users[user] = true
+}
+
+// Removes the user from the online users of the username it is logged in to.
+func (cm *ServerManager) disconnect(user *User) {
+	users := cm.online[user.username]
+	delete(users, user)
+	if len(users) == 0 {
+		delete(cm.online, user.username)
+	}
+}
+
+// Sends the unread counts of the chats the sender of the request has joined, it is sent after logging in.
+// getUnreadCounts is the statement of the unreadCountsQuery.
+func (cm *ServerManager) sendUnreadCounts(req ClientRequest, getUnreadCounts *sql.Stmt) UnreadList {
+	cm.mu.RLock()
+	rows, err := getUnreadCounts.Query(req.sender.username)
+	cm.mu.RUnlock()
+	if err != nil {
+		log.Println("Error: Could not query unread counts:", err)
+		return nil
+	}
+
+	counts, err := scanUnreadCounts(rows)
+	if err != nil {
+		log.Println("Error: Could not read unread counts:", err)
+		return nil
+	}
+	req.sender.send(req.ReplyData("n", "unread", counts))
+	return counts
+}
+
+// Checks whether the sender of the request can do the action on the user with the username in the chat.
+// the sender needs a role that can do the action and that is more powerful than the role of the user.
+// returns the role of the user, or an empty string if the user hasn't joined the chat.
+// if the sender can't do the action an error is sent to the sender and false is returned.
+func (cm *ServerManager) checkActOnMember(req ClientRequest, chatId string, username string, action string, getRole *sql.Stmt) (string, bool) {
+	cm.mu.RLock()
+	role, err := getMemberRole(getRole, req.sender.username, chatId)
+	cm.mu.RUnlock()
+	if err == sql.ErrNoRows {
+		req.sender.send(req.Error(ErrorCodeNotJoined, "Not a member of " + chatId))
+		return "", false
+	} else if err != nil {
+		log.Println("Error: Could not get role:", err)
+		req.sender.send(req.Error(ErrorCodeInternal, "An error occured"))
+		return "", false
+	}
+
+	cm.mu.RLock()
+	targetRole, err := getMemberRole(getRole, username, chatId)
+	cm.mu.RUnlock()
+	if err != nil && err != sql.ErrNoRows {
+		log.Println("Error: Could not get role:", err)
+		req.sender.send(req.Error(ErrorCodeInternal, "An error occured"))
+		return "", false
+	}
+
+	if !CanPerform(role, action) || !Outranks(role, targetRole) {
+		req.sender.send(req.Error(ErrorCodeNotAllowed, "You are not allowed to " + action + " " + username))
+		return "", false
+	}
+	return targetRole, true
+}
+
+// Handles user requests.
+// requests are handled one at a time, requests that hash or check a password with bcrypt (li, nu, du, jo, nc, dc, cp, pw) do it on another goroutine
+// and are handled again when it is done, so they don't delay the requests after them.
+func (cm *ServerManager) HandleRequests() {
+	// foreign keys are enabled for every connection, "PRAGMA foreign_keys" would only enable them for one connection of the pool.
+	db, err := sql.Open("sqlite3", DatabasePath + "?_foreign_keys=on")
+	if err != nil {
+		log.Fatalln("ERROR: FAILED TO OPEN DATABASE:", err)
+	}
+	defer db.Close()
+
+	getChats, err := db.Prepare("SELECT chatId FROM joined WHERE username=?")
+	if err != nil {
+		log.Fatalln("ERROR: FAILED TO PREPARE STATEMENT:", err)
+	}
+	defer getChats.Close()
+
+	getUser, err := db.Prepare("SELECT name, password FROM users WHERE username=?")
+	if err != nil {
+		log.Fatalln("ERROR: FAILED TO PREPARE STATEMENT:", err)
+	}
+	defer getUser.Close()
+
+	addUser, err := db.Prepare("INSERT INTO users (username, name, password) VALUES (?, ?, ?)")
+	if err != nil {
+		log.Fatalln("ERROR: FAILED TO PREPARE STATEMENT:", err)
+	}
+	defer addUser.Close()
+
+	getChat, err := db.Prepare("SELECT chatName, password FROM chats WHERE chatId = ?")
+	if err != nil {
+		log.Fatalln("ERROR: FAILED TO PREPARE STATEMENT:", err)
+	}
+	defer getChat.Close()
+
+	joinChat, err := db.Prepare("INSERT INTO joined (username, chatId, role) VALUES (?, ?, ?)")
+	if err != nil {
+		log.Fatalln("ERROR: FAILED TO PREPARE STATEMENT:", err)
+	}
+	defer joinChat.Close()
+
+	leaveChat, err := db.Prepare("DELETE FROM joined WHERE username = ? and chatId = ?")
+	if err != nil {
+		log.Fatalln("ERROR: FAILED TO PREPARE STATEMENT:", err)
+	}
+	defer leaveChat.Close()
+
+	addChat, err := db.Prepare("INSERT INTO chats (chatId, chatName, password, owner) VALUES (?, ?, ?, ?)")
+	if err != nil {
+		log.Fatalln("ERROR: FAILED TO PREPARE STATEMENT:", err)
+	}
+	defer addChat.Close()
+
+	getOwner, err := db.Prepare("SELECT owner FROM chats WHERE chatId = ?")
+	if err != nil {
+		log.Fatalln("ERROR: FAILED TO PREPARE STATEMENT:", err)
+	}
+	defer getOwner.Close()
+
+	deleteChat, err := db.Prepare("DELETE FROM chats WHERE chatId = ?")
+	if err != nil {
+		log.Fatalln("ERROR: FAILED TO PREPARE STATEMENT:", err)
+	}
+	defer deleteChat.Close()
+
+	getUnreadCounts, err := db.Prepare(unreadCountsQuery)
+	if err != nil {
+		log.Fatalln("ERROR: FAILED TO PREPARE STATEMENT:", err)
+	}
+	defer getUnreadCounts.Close()
+
+	getMissedMessages, err := db.Prepare(missedMessagesQuery)
+	if err != nil {
+		log.Fatalln("ERROR: FAILED TO PREPARE STATEMENT:", err)
+	}
+	defer getMissedMessages.Close()
+
+	getChatSummaries, err := db.Prepare(chatSummariesQuery)
+	if err != nil {
+		log.Fatalln("ERROR: FAILED TO PREPARE STATEMENT:", err)
+	}
+	defer getChatSummaries.Close()
+
+	addSession, err := db.Prepare("INSERT INTO sessions (tokenHash, username, expires_at) VALUES (?, ?, ?)")
+	if err != nil {
+		log.Fatalln("ERROR: FAILED TO PREPARE STATEMENT:", err)
+	}
+	defer addSession.Close()
+
+	getSession, err := db.Prepare("SELECT users.username, users.name FROM sessions JOIN users ON users.username = sessions.username WHERE sessions.tokenHash = ? and sessions.expires_at > datetime('now')")
+	if err != nil {
+		log.Fatalln("ERROR: FAILED TO PREPARE STATEMENT:", err)
+	}
+	defer getSession.Close()
+
+	deleteSession, err := db.Prepare("DELETE FROM sessions WHERE tokenHash = ?")
+	if err != nil {
+		log.Fatalln("ERROR: FAILED TO PREPARE STATEMENT:", err)
+	}
+	defer deleteSession.Close()
+
+	_, err = db.Exec("DELETE FROM sessions WHERE expires_at <= datetime('now')")
+	if err != nil {
+		log.Fatalln("ERROR: COULD NOT DELETE EXPIRED SESSIONS:", err)
+	}
+
+	getRole, err := db.Prepare("SELECT role FROM joined WHERE username = ? and chatId = ?")
+	if err != nil {
+		log.Fatalln("ERROR: FAILED TO PREPARE STATEMENT:", err)
+	}
+	defer getRole.Close()
+
+	setRole, err := db.Prepare("UPDATE joined SET role = ? WHERE username = ? and chatId = ?")
+	if err != nil {
+		log.Fatalln("ERROR: FAILED TO PREPARE STATEMENT:", err)
+	}
+	defer setRole.Close()
+
+	banUser, err := db.Prepare(banStatement)
+	if err != nil {
+		log.Fatalln("ERROR: FAILED TO PREPARE STATEMENT:", err)
+	}
+	defer banUser.Close()
+
+	getBan, err := db.Prepare(activeBanQuery)
+	if err != nil {
+		log.Fatalln("ERROR: FAILED TO PREPARE STATEMENT:", err)
+	}
+	defer getBan.Close()
+
+	unbanUser, err := db.Prepare("DELETE FROM bans WHERE chatId = ? and username = ?")
+	if err != nil {
+		log.Fatalln("ERROR: FAILED TO PREPARE STATEMENT:", err)
+	}
+	defer unbanUser.Close()
+
+	isJoined, err := db.Prepare("SELECT 1 FROM joined WHERE username = ? and chatId = ?")
+	if err != nil {
+		log.Fatalln("ERROR: FAILED TO PREPARE STATEMENT:", err)
+	}
+	defer isJoined.Close()
+
+	renameChat, err := db.Prepare("UPDATE chats SET chatName = ? WHERE chatId = ?")
+	if err != nil {
+		log.Fatalln("ERROR: FAILED TO PREPARE STATEMENT:", err)
+	}
+	defer renameChat.Close()
+
+	setChatPassword, err := db.Prepare("UPDATE chats SET password = ? WHERE chatId = ?")
+	if err != nil {
+		log.Fatalln("ERROR: FAILED TO PREPARE STATEMENT:", err)
+	}
+	defer setChatPassword.Close()
+
+	setName, err := db.Prepare("UPDATE users SET name = ? WHERE username = ?")
+	if err != nil {
+		log.Fatalln("ERROR: FAILED TO PREPARE STATEMENT:", err)
+	}
+	defer setName.Close()
+
+	addInvite, err := db.Prepare(addInviteStatement)
+	if err != nil {
+		log.Fatalln("ERROR: FAILED TO PREPARE STATEMENT:", err)
+	}
+	defer addInvite.Close()
+
+	getInvite, err := db.Prepare(validInviteQuery)
+	if err != nil {
+		log.Fatalln("ERROR: FAILED TO PREPARE STATEMENT:", err)
+	}
+	defer getInvite.Close()
+
+	getInviteChat, err := db.Prepare("SELECT chatId FROM invites WHERE code = ?")
+	if err != nil {
+		log.Fatalln("ERROR: FAILED TO PREPARE STATEMENT:", err)
+	}
+	defer getInviteChat.Close()
+
+	deleteInvite, err := db.Prepare("DELETE FROM invites WHERE code = ?")
+	if err != nil {
+		log.Fatalln("ERROR: FAILED TO PREPARE STATEMENT:", err)
+	}
+	defer deleteInvite.Close()
+
+	setVisibility, err := db.Prepare("UPDATE chats SET visibility = ? WHERE chatId = ?")
+	if err != nil {
+		log.Fatalln("ERROR: FAILED TO PREPARE STATEMENT:", err)
+	}
+	defer setVisibility.Close()
+
+	getMemberCount, err := db.Prepare("SELECT COUNT(*) FROM joined WHERE chatId = ?")
+	if err != nil {
+		log.Fatalln("ERROR: FAILED TO PREPARE STATEMENT:", err)
+	}
+	defer getMemberCount.Close()
+
+	for {
+		req := <- cm.ManagerChan
+		if (req.check != nil || req.hashed != nil) && req.sender.hasQuit() {
+			continue
+		}
+
+		switch req.string {
+		case LoginRequestType:
+			username, sentPassword := req.args[0], req.args[1]
+
+			// another login of the connection could have finished while the password was checked.
+			if req.sender.connected {
+				req.sender.send(req.Error(ErrorCodeAlreadyLoggedIn, "Already logged in"))
+				continue
+			}
+
+			var password string
+			var nickname string
+
+			username = strings.TrimSpace(username)
+			cm.mu.RLock()
+			err := getUser.QueryRow(username).Scan(&nickname, &password)
+			cm.mu.RUnlock()
+			if err == sql.ErrNoRows {
+				req.sender.send(req.Error(ErrorCodeAuthFailed, "Wrong username or password"))
+				continue
+			} else if err != nil {
+				log.Println("Error: Could not search for user", err)
+				req.sender.send(req.Error(ErrorCodeInternal, "An error occured"))
+				continue
+			}
+
+			ok, done := cm.checkPassword(req, password, sentPassword)
+			if !done {
+				continue
+			}
+			if !ok {
+				req.sender.send(req.Error(ErrorCodeAuthFailed, "Wrong username or password"))
+				continue
+			}
+
+			session, err := cm.newSession(username, addSession)
+			if err != nil {
+				log.Println("Error: Could not create session:", err)
+				req.sender.send(req.Error(ErrorCodeInternal, "An error occured"))
+				continue
+			}
+
+			err = cm.connectUser(req.sender, username, nickname, getChats)
+			if err != nil {
+				log.Println("Error: Unable to query logged_in table:", err)
+				req.sender.send(req.Error(ErrorCodeInternal, "An error occured"))
+				continue
+			}
+			req.sender.token = session.Token
+			cm.goOnline(req.sender)
+			req.sender.send(req.ReplyData("a", "connected", session))
+			counts := cm.sendUnreadCounts(req, getUnreadCounts)
+			cm.sendMissedMessages(req, counts, getMissedMessages)
+
+		case ResumeRequestType:
+			token := req.args[0]
+
+			var username, nickname string
+			cm.mu.RLock()
+			err := getSession.QueryRow(hashSessionToken(token)).Scan(&username, &nickname)
+			cm.mu.RUnlock()
+			if err == sql.ErrNoRows {
+				req.sender.send(req.Error(ErrorCodeAuthFailed, "Session expired or revoked"))
+				continue
+			} else if err != nil {
+				log.Println("Error: Could not search for session", err)
+				req.sender.send(req.Error(ErrorCodeInternal, "An error occured"))
+				continue
+			}
+
+			err = cm.connectUser(req.sender, username, nickname, getChats)
+			if err != nil {
+				log.Println("Error: Unable to query logged_in table:", err)
+				req.sender.send(req.Error(ErrorCodeInternal, "An error occured"))
+				continue
+			}
+			req.sender.token = token
+			cm.goOnline(req.sender)
+			req.sender.send(req.Reply("a", "resumed"))
+			counts := cm.sendUnreadCounts(req, getUnreadCounts)
+			cm.sendMissedMessages(req, counts, getMissedMessages)
+
+		case LogoutRequestType:
+			token := req.args[1]
+			cm.disconnect(req.sender)
+
+			cm.mu.Lock()
+			_, err := deleteSession.Exec(hashSessionToken(token))
+			cm.mu.Unlock()
+			if err != nil {
+				log.Println("Error: Could not revoke session:", err)
+			}
+
+		case NewUserRequestType:
+			username, name, password := req.args[0], req.args[1], req.args[2]
+
+			// another login of the connection could have finished while the password was hashed.
+			if req.sender.connected {
+				req.sender.send(req.Error(ErrorCodeAlreadyLoggedIn, "Already logged in"))
+				continue
+			}
+
+			hash, done, err := cm.hashPassword(req, password)
+			if !done {
+				continue
+			}
+			if err != nil {
+				req.sender.send(req.Error(ErrorCodeBadRequest, "Could not use password: " + err.Error()))
+				continue
+			}
+
+			cm.mu.Lock()
+			_, err = addUser.Exec(username, name, hash)
+			cm.mu.Unlock()
+			if err != nil {
+				if sqliteErr, ok := err.(sqlite3.Error); ok {
+					if sqliteErr.Code == sqlite3.ErrConstraint {
+						req.sender.send(req.Error(ErrorCodeUsernameTaken, "Username already taken"))
+						continue
+					}
+				}
+				log.Println("Error: Could not add user to users table", err)
+				req.sender.send(req.Error(ErrorCodeInternal, "An error occured"))
+				continue
+			}
+
+			session, err := cm.newSession(username, addSession)
+			if err != nil {
+				log.Println("Error: Could not create session:", err)
+				req.sender.send(req.Error(ErrorCodeInternal, "An error occured"))
+				continue
+			}
+
+			req.sender.username = username
+			req.sender.name = name
+			req.sender.connected = true
+			req.sender.token = session.Token
+			cm.goOnline(req.sender)
+			req.sender.send(req.ReplyData("a", "User Created and logged in", session))
+
+		case DeleteUserRequestType:
+			password := req.args[0]
+
+			var nickname, hash string
+			cm.mu.RLock()
+			err := getUser.QueryRow(req.sender.username).Scan(&nickname, &hash)
+			cm.mu.RUnlock()
+			if err != nil {
+				log.Println("Error: Could not search for user", err)
+				req.sender.send(req.Error(ErrorCodeInternal, "An error occured"))
+				continue
+			}
+
+			ok, done := cm.checkPassword(req, hash, password)
+			if !done {
+				continue
+			}
+			if !ok {
+				req.sender.send(req.Error(ErrorCodeAuthFailed, "Wrong password"))
+				continue
+			}
+
+			cm.mu.Lock()
+			res, directChats, err := deleteUserAndDirectChats(db, req.sender.username)
+			cm.mu.Unlock()
+			if sqliteErr, ok := err.(sqlite3.Error); ok {
+				if sqliteErr.Code == sqlite3.ErrNo(sqlite3.ErrConstraint) {
+					req.sender.send(req.Error(ErrorCodeIsOwner, "You are the owner of at least one chat, delete or transfer ownership of the chats first."))
+					continue
+				}
+			}
+			if err != nil {
+				log.Println("Error: Could not delete user:", err)
+				req.sender.send(req.Error(ErrorCodeInternal, "An error occured"))
+				continue
+			}
+
+			affected, err := res.RowsAffected()
+			if err != nil {
+				log.Println("Error: Could not get affected rows number:", err)
+				req.sender.send(req.Error(ErrorCodeInternal, "An error occured"))
+				continue
+			}
+
+			if affected == 0 {
+				req.sender.send(req.Error(ErrorCodeAuthFailed, "No such user"))
+				continue
+			}
+
+			for _, chatId := range req.sender.chatIds() {
+				cm.disconnectFromChat(chatId, req.sender.username, Message{})
+			}
+			for _, chatId := range directChats {
+				cm.chats[chatId].chatChan <- DeleteChatRequest(chatId, "", req.sender)
+				delete(cm.chats, chatId)
+			}
+
+			for user := range cm.online[req.sender.username] {
+				if user != req.sender {
+					user.disconnect(NewMessage("n", "Your user was deleted"))
+				}
+			}
+			delete(cm.online, req.sender.username)
+			req.sender.username = ""
+			req.sender.connected = false
+			req.sender.token = ""
+			req.sender.send(req.Reply("a", "User deleted"))
+		
+		case JoinChatRequestType:
+			chatId, sentChatPassword := req.args[0], req.args[1]
+
+			var chatName string
+			var chatPassword string
+
+			chatId = strings.TrimSpace(chatId)
+			cm.mu.RLock()
+			err := getChat.QueryRow(chatId).Scan(&chatName, &chatPassword)
+			cm.mu.RUnlock()
+			if err == sql.ErrNoRows {
+				req.sender.send(req.Error(ErrorCodeChatNotFound, "No Such Chat"))
+				continue
+			} else if err != nil {
+				log.Println("Error: Could not search for user", err)
+				req.sender.send(req.Error(ErrorCodeInternal, "An error occured"))
+				continue
+			}
+
+			if isDirectChatId(chatId) {
+				req.sender.send(req.Error(ErrorCodeNotAllowed, "Direct chats can't be joined"))
+				continue
+			}
+
+			ban := Removal{Username: req.sender.username}
+			cm.mu.RLock()
+			err = getBan.QueryRow(chatId, req.sender.username).Scan(&ban.By, &ban.Reason, &ban.ExpiresAt)
+			cm.mu.RUnlock()
+			if err == nil {
+				req.sender.send(req.ErrorData(ErrorCodeBanned, "You are banned from " + chatId, ban))
+				continue
+			} else if err != sql.ErrNoRows {
+				log.Println("Error: Could not search for ban:", err)
+				req.sender.send(req.Error(ErrorCodeInternal, "An error occured"))
+				continue
+			}
+
+			if !cm.chats[chatId].public {
+				ok, done := cm.checkPassword(req, chatPassword, sentChatPassword)
+				if !done {
+					continue
+				}
+				if !ok {
+					req.sender.send(req.Error(ErrorCodeAuthFailed, "Wrong chat password"))
+					continue
+				}
+			}
+
+			var joined int
+			cm.mu.RLock()
+			err = isJoined.QueryRow(req.sender.username, chatId).Scan(&joined)
+			cm.mu.RUnlock()
+			if err == nil {
+				req.sender.send(req.Error(ErrorCodeAlreadyJoined, "Already joined " + chatId))
+				continue
+			} else if err != sql.ErrNoRows {
+				log.Println("Error: Could not check if user joined chat:", err)
+				req.sender.send(req.Error(ErrorCodeInternal, "An error occured"))
+				continue
+			}
+
+			cm.mu.Lock()
+			_, err = joinChat.Exec(req.sender.username, chatId, RoleMember)
+			cm.mu.Unlock()
+			if err != nil {
+				log.Println("Error: Could not join user to chat:", err)
+				req.sender.send(req.Error(ErrorCodeInternal, "An error occured"))
+				continue
+			}
+
+			req.sender.send(req.Reply("a", "Joined " + chatId))
+			cm.connectOnline(req.sender.username, cm.chats[chatId])
+
+		case LeaveChatRequestType:
+			chatId := req.args[0]
+			
+			var owner string
+			cm.mu.RLock()
+			err := getOwner.QueryRow(chatId).Scan(&owner)
+			cm.mu.RUnlock()
+			if err == sql.ErrNoRows {
+				req.sender.send(req.Error(ErrorCodeChatNotFound, "No Such Chat"))
+				continue
+			} else if err != nil {
+				log.Println("Error: Could not leave chat:", err)
+				req.sender.send(req.Error(ErrorCodeInternal, "An error occured"))
+				continue
+			}
+
+			if isDirectChatId(chatId) {
+				req.sender.send(req.Error(ErrorCodeNotAllowed, "Direct chats can't be left"))
+				continue
+			}
+
+			if owner == req.sender.username {
+				req.sender.send(req.Error(ErrorCodeIsOwner, "You are the owner of the chat, transfer the ownership of the chat or delete the chat."))
+				continue
+			}
+
+			cm.mu.Lock()
+			res, err := leaveChat.Exec(req.sender.username, chatId)
+			cm.mu.Unlock()
+			if err != nil {
+				log.Println("Error: Could not leave chat:", err)
+				req.sender.send(req.Error(ErrorCodeInternal, "An error occured"))
+				continue
+			}
+
+			affected, err := res.RowsAffected()
+			if err != nil {
+				log.Println("Error: Could not get affected rows number:", err)
+				req.sender.send(req.Error(ErrorCodeInternal, "An error occured"))
+				continue
+			}
+
+			if affected == 0 {
+				req.sender.send(req.Error(ErrorCodeNotJoined, "Not a member of " + chatId))
+				continue
+			}
+
+			cm.disconnectFromChat(chatId, req.sender.username, Message{})
+			req.sender.send(req.Reply("a", "Left " + chatId))
+
+		case NewChatRequestType:
+			chatId, chatName, password := req.args[0], req.args[1], req.args[2]
+
+			if isDirectChatId(chatId) {
+				req.sender.send(req.Error(ErrorCodeBadRequest, "Chat ids starting with " + DirectChatPrefix + " are reserved for direct chats"))
+				continue
+			}
+
+			hash, done, err := cm.hashPassword(req, password)
+			if !done {
+				continue
+			}
+			if err != nil {
+				req.sender.send(req.Error(ErrorCodeBadRequest, "Could not use password: " + err.Error()))
+				continue
+			}
+
+			cm.mu.Lock()
+			_, err = addChat.Exec(chatId, chatName, hash, req.sender.username)
+			cm.mu.Unlock()
+			if sqliteErr, ok := err.(sqlite3.Error); ok {
+				if sqliteErr.Code == sqlite3.ErrConstraint {
+					req.sender.send(req.Error(ErrorCodeChatIdTaken, "ChatId already taken"))
+					continue
+				}
+			}
+			if err != nil {
+				log.Println("Error: Could not add chat to chata table", err)
+				req.sender.send(req.Error(ErrorCodeInternal, "An error occured"))
+				continue
+			}
+			
+			newChat := NewChat(chatId, chatName, req.sender.username, false, cm.mu)
+			cm.chats[chatId] = newChat
+			go newChat.HandleRequests()
+			req.sender.send(req.Reply("a", "Created new chat: " + chatId))
+
+			cm.mu.Lock()
+			_, err = joinChat.Exec(req.sender.username, chatId, RoleOwner)
+			cm.mu.Unlock()
+			if err != nil {
+				log.Println("Error: Could not join user to chat:", err)
+				req.sender.send(req.Error(ErrorCodeInternal, "An error occured"))
+				continue
+			}
+
+			req.sender.send(req.Reply("n", "Joined " + chatId))
+			cm.connectOnline(req.sender.username, cm.chats[chatId])
+
+		case DeleteChatRequestType:
+			chatId, chatPassword := req.args[0], req.args[1]
+
+			var owner string
+			cm.mu.RLock()
+			err := getOwner.QueryRow(chatId).Scan(&owner)
+			cm.mu.RUnlock()
+			if err == sql.ErrNoRows {
+				req.sender.send(req.Error(ErrorCodeChatNotFound, "No Such Chat"))
+				continue
+			} else if err != nil {
+				log.Println("Error: Could not leave chat:", err)
+				req.sender.send(req.Error(ErrorCodeInternal, "An error occured"))
+				continue
+			}
+
+			cm.mu.RLock()
+			role, err := getMemberRole(getRole, req.sender.username, chatId)
+			cm.mu.RUnlock()
+			if err != nil && err != sql.ErrNoRows {
+				log.Println("Error: Could not get role:", err)
+				req.sender.send(req.Error(ErrorCodeInternal, "An error occured"))
+				continue
+			}
+
+			if !CanPerform(role, DeleteChatPermission) {
+				req.sender.send(req.Error(ErrorCodeNotOwner, "You are not the owner of the chat"))
+				continue
+			}
+
+			var chatName, hash string
+			cm.mu.RLock()
+			err = getChat.QueryRow(chatId).Scan(&chatName, &hash)
+			cm.mu.RUnlock()
+			if err != nil {
+				log.Println("Error: Could not search for chat", err)
+				req.sender.send(req.Error(ErrorCodeInternal, "An error occured"))
+				continue
+			}
+
+			ok, done := cm.checkPassword(req, hash, chatPassword)
+			if !done {
+				continue
+			}
+			if !ok {
+				req.sender.send(req.Error(ErrorCodeAuthFailed, "Wrong chat password"))
+				continue
+			}
+
+			cm.mu.Lock()
+			res, err := deleteChat.Exec(chatId)
+			cm.mu.Unlock()
+			if err != nil {
+				log.Println("Error: Could not delete user:", err)
+				req.sender.send(req.Error(ErrorCodeInternal, "An error occured"))
+				continue
+			}
+
+			affected, err := res.RowsAffected()
+			if err != nil {
+				log.Println("Error: Could not get affected rows number:", err)
+				req.sender.send(req.Error(ErrorCodeInternal, "An error occured"))
+				continue
+			}
+
+			if affected == 0 {
+				req.sender.send(req.Error(ErrorCodeChatNotFound, "No Such Chat"))
+				continue
+			}
+
+			cm.chats[chatId].chatChan <- DeleteChatRequest(chatId, chatPassword, req.sender)
+			delete(cm.chats, chatId)
+			req.sender.send(req.Reply("a", "Deleted " + chatId))
+
+		case SetRoleRequestType:
+			chatId, username, newRole := req.args[0], req.args[1], req.args[2]
+
+			cm.mu.RLock()
+			role, err := getMemberRole(getRole, req.sender.username, chatId)
+			cm.mu.RUnlock()
+			if err == sql.ErrNoRows {
+				req.sender.send(req.Error(ErrorCodeNotJoined, "Not a member of " + chatId))
+				continue
+			} else if err != nil {
+				log.Println("Error: Could not get role:", err)
+				req.sender.send(req.Error(ErrorCodeInternal, "An error occured"))
+				continue
+			}
+
+			cm.mu.RLock()
+			targetRole, err := getMemberRole(getRole, username, chatId)
+			cm.mu.RUnlock()
+			if err == sql.ErrNoRows {
+				req.sender.send(req.Error(ErrorCodeNotJoined, username + " is not a member of " + chatId))
+				continue
+			} else if err != nil {
+				log.Println("Error: Could not get role:", err)
+				req.sender.send(req.Error(ErrorCodeInternal, "An error occured"))
+				continue
+			}
+
+			if !CanPerform(role, SetRolePermission) || !Outranks(role, targetRole) || !Outranks(role, newRole) {
+				req.sender.send(req.Error(ErrorCodeNotAllowed, "You can only change the roles of members below you to roles below yours"))
+				continue
+			}
+
+			cm.mu.Lock()
+			_, err = setRole.Exec(newRole, username, chatId)
+			cm.mu.Unlock()
+			if err != nil {
+				log.Println("Error: Could not set role:", err)
+				req.sender.send(req.Error(ErrorCodeInternal, "An error occured"))
+				continue
+			}
+
+			req.sender.send(req.Reply("a", username + " is now " + newRole))
+			cm.broadcast(chatId, NewEvent(RoleChangedEvent, chatId, RoleChange{Username: username, Role: newRole, ChangedBy: req.sender.username}), nil)
+
+		case KickRequestType:
+			chatId, username := req.args[0], req.args[1]
+
+			targetRole, ok := cm.checkActOnMember(req, chatId, username, KickPermission, getRole)
+			if !ok {
+				continue
+			}
+			if targetRole == "" {
+				req.sender.send(req.Error(ErrorCodeNotJoined, username + " is not a member of " + chatId))
+				continue
+			}
+
+			cm.mu.Lock()
+			_, err = leaveChat.Exec(username, chatId)
+			cm.mu.Unlock()
+			if err != nil {
+				log.Println("Error: Could not kick member:", err)
+				req.sender.send(req.Error(ErrorCodeInternal, "An error occured"))
+				continue
+			}
+
+			req.sender.send(req.Reply("a", "Kicked " + username))
+			cm.disconnectFromChat(chatId, username, NewEvent(MemberKickedEvent, chatId, Removal{Username: username, By: req.sender.username}))
+
+		case BanRequestType:
+			chatId, username, duration, reason := req.args[0], req.args[1], req.args[2], req.args[3]
+
+			expiresAt, err := parseExpiry(duration)
+			if err != nil {
+				req.sender.send(req.Error(ErrorCodeBadRequest, "Invalid ban duration, use " + PermanentBan + " or a duration such as 24h"))
+				continue
+			}
+
+			var nickname, hash string
+			cm.mu.RLock()
+			err = getUser.QueryRow(username).Scan(&nickname, &hash)
+			cm.mu.RUnlock()
+			if err == sql.ErrNoRows {
+				req.sender.send(req.Error(ErrorCodeUserNotFound, "No such user " + username))
+				continue
+			} else if err != nil {
+				log.Println("Error: Could not search for user", err)
+				req.sender.send(req.Error(ErrorCodeInternal, "An error occured"))
+				continue
+			}
+
+			targetRole, ok := cm.checkActOnMember(req, chatId, username, BanPermission, getRole)
+			if !ok {
+				continue
+			}
+
+			cm.mu.Lock()
+			_, err = banUser.Exec(chatId, username, req.sender.username, reason, expiresAt)
+			cm.mu.Unlock()
+			if err != nil {
+				log.Println("Error: Could not ban user:", err)
+				req.sender.send(req.Error(ErrorCodeInternal, "An error occured"))
+				continue
+			}
+
+			removal := Removal{Username: username, By: req.sender.username, Reason: reason}
+			if expiresAt != nil {
+				removal.ExpiresAt = expiresAt.(string)
+			}
+			if targetRole != "" {
+				cm.mu.Lock()
+				_, err = leaveChat.Exec(username, chatId)
+				cm.mu.Unlock()
+				if err != nil {
+					log.Println("Error: Could not remove banned member:", err)
+					req.sender.send(req.Error(ErrorCodeInternal, "An error occured"))
+					continue
 				}
-			} else if err != nil{
-				log.Println("Error: Could not add chat to chata table", err)
 			}
-			
-			newChat := NewChat(chatId, chatName, req.sender.username, cm.mu)
-			cm.chats[chatId] = newChat
-			req.sender.chats[chatId] = newChat.chatChan
-			go newChat.HandleRequests()
-			req.sender.messages <- NewMessage("n", "Created new chat: " + chatId)
+
+			req.sender.send(req.Reply("a", "Banned " + username))
+			cm.disconnectFromChat(chatId, username, NewEvent(MemberBannedEvent, chatId, removal))
+
+		case UnbanRequestType:
+			chatId, username := req.args[0], req.args[1]
+
+			cm.mu.RLock()
+			role, err := getMemberRole(getRole, req.sender.username, chatId)
+			cm.mu.RUnlock()
+			if err != nil && err != sql.ErrNoRows {
+				log.Println("Error: Could not get role:", err)
+				req.sender.send(req.Error(ErrorCodeInternal, "An error occured"))
+				continue
+			}
+
+			if !CanPerform(role, BanPermission) {
+				req.sender.send(req.Error(ErrorCodeNotAllowed, "Only admins of the chat can unban users"))
+				continue
+			}
 
 			cm.mu.Lock()
-			res, err := joinChat.Exec(req.sender.username, chatId)
+			res, err := unbanUser.Exec(chatId, username)
 			cm.mu.Unlock()
 			if err != nil {
-				log.Println("Error: Could not join user to chat:", err)
-				req.sender.messages <- NewMessage("e", "An error occured")
+				log.Println("Error: Could not unban user:", err)
+				req.sender.send(req.Error(ErrorCodeInternal, "An error occured"))
+				continue
 			}
 
 			affected, err := res.RowsAffected()
 			if err != nil {
 				log.Println("Error: Could not get affected rows number:", err)
-				req.sender.messages <- NewMessage("e", "An error occured")
+				req.sender.send(req.Error(ErrorCodeInternal, "An error occured"))
+				continue
 			}
 
-			if affected == 1 {
-				req.sender.messages <- NewMessage("n", "Joined " + chatId)
-				req.sender.chats[chatId] = cm.chats[chatId].chatChan
-				cm.chats[chatId].users[req.sender.username] = req.sender
+			if affected == 0 {
+				req.sender.send(req.Error(ErrorCodeNotBanned, username + " is not banned from " + chatId))
+				continue
 			}
+			req.sender.send(req.Reply("a", "Unbanned " + username))
 
-		case DeleteChatRequestType:
-			chatId, chatPassword, _ := strings.Cut(req.content, " ")
+		case TransferOwnershipRequestType:
+			chatId, newOwner := req.args[0], req.args[1]
 
-			var owner string
 			cm.mu.RLock()
-			err := getOwner.QueryRow(chatId).Scan(&owner)
+			role, err := getMemberRole(getRole, req.sender.username, chatId)
+			cm.mu.RUnlock()
+			if err != nil && err != sql.ErrNoRows {
+				log.Println("Error: Could not get role:", err)
+				req.sender.send(req.Error(ErrorCodeInternal, "An error occured"))
+				continue
+			}
+
+			if role != RoleOwner {
+				req.sender.send(req.Error(ErrorCodeNotOwner, "You are not the owner of the chat"))
+				continue
+			}
+
+			if newOwner == req.sender.username {
+				req.sender.send(req.Error(ErrorCodeBadRequest, "You are already the owner of the chat"))
+				continue
+			}
+
+			cm.mu.RLock()
+			_, err = getMemberRole(getRole, newOwner, chatId)
 			cm.mu.RUnlock()
+			if err == sql.ErrNoRows {
+				req.sender.send(req.Error(ErrorCodeNotJoined, newOwner + " is not a member of " + chatId))
+				continue
+			} else if err != nil {
+				log.Println("Error: Could not get role:", err)
+				req.sender.send(req.Error(ErrorCodeInternal, "An error occured"))
+				continue
+			}
+
+			cm.mu.Lock()
+			err = transferOwnership(db, chatId, req.sender.username, newOwner)
+			cm.mu.Unlock()
 			if err != nil {
-				log.Println("Error: Could not leave chat:", err)
-				req.sender.messages <- NewMessage("e", "An error occured")
+				log.Println("Error: Could not transfer ownership:", err)
+				req.sender.send(req.Error(ErrorCodeInternal, "An error occured"))
+				continue
+			}
+
+			chat := cm.chats[chatId]
+			chat.owner = newOwner
+			req.sender.send(req.Reply("a", newOwner + " is now the owner of " + chatId))
+			cm.broadcast(chatId, NewEvent(OwnerChangedEvent, chatId, OwnerChange{Owner: newOwner, PreviousOwner: req.sender.username}), nil)
+
+		case RenameChatRequestType:
+			chatId, chatName := req.args[0], req.args[1]
+
+			cm.mu.RLock()
+			role, err := getMemberRole(getRole, req.sender.username, chatId)
+			cm.mu.RUnlock()
+			if err != nil && err != sql.ErrNoRows {
+				log.Println("Error: Could not get role:", err)
+				req.sender.send(req.Error(ErrorCodeInternal, "An error occured"))
 				continue
 			}
 
-			if owner != req.sender.username {
-				req.sender.messages <- NewMessage("n", "You are not the owner of the chat")
+			if !CanPerform(role, RenameChatPermission) {
+				req.sender.send(req.Error(ErrorCodeNotAllowed, "Only admins of the chat can rename it"))
 				continue
 			}
 
 			cm.mu.Lock()
-			res, err := deleteChat.Exec(chatId, chatPassword)
+			_, err = renameChat.Exec(chatName, chatId)
 			cm.mu.Unlock()
 			if err != nil {
-				log.Println("Error: Could not delete user:", err)
+				log.Println("Error: Could not rename chat:", err)
+				req.sender.send(req.Error(ErrorCodeInternal, "An error occured"))
+				continue
 			}
 
-			affected, err := res.RowsAffected()
+			chat := cm.chats[chatId]
+			chat.chatName = chatName
+			req.sender.send(req.Reply("a", "Renamed " + chatId + " to " + chatName))
+			cm.broadcast(chatId, NewEvent(ChatRenamedEvent, chatId, ChatRename{ChatName: chatName, RenamedBy: req.sender.username}), nil)
+
+		case ChangeChatPasswordRequestType:
+			chatId, password := req.args[0], req.args[1]
+
+			cm.mu.RLock()
+			role, err := getMemberRole(getRole, req.sender.username, chatId)
+			cm.mu.RUnlock()
+			if err != nil && err != sql.ErrNoRows {
+				log.Println("Error: Could not get role:", err)
+				req.sender.send(req.Error(ErrorCodeInternal, "An error occured"))
+				continue
+			}
+
+			if !CanPerform(role, ChangeChatPasswordPermission) {
+				req.sender.send(req.Error(ErrorCodeNotAllowed, "Only admins of the chat can change its password"))
+				continue
+			}
+
+			hash, done, err := cm.hashPassword(req, password)
+			if !done {
+				continue
+			}
 			if err != nil {
-				log.Println("Error: Could not get affected rows number:", err)
+				req.sender.send(req.Error(ErrorCodeBadRequest, "Could not use password: " + err.Error()))
+				continue
 			}
 
-			if affected != 0 {
-				cm.chats[chatId].chatChan <- DeleteChatRequest(chatId, chatPassword, req.sender)
-				delete(cm.chats, chatId)
+			cm.mu.Lock()
+			_, err = setChatPassword.Exec(hash, chatId)
+			cm.mu.Unlock()
+			if err != nil {
+				log.Println("Error: Could not change chat password:", err)
+				req.sender.send(req.Error(ErrorCodeInternal, "An error occured"))
+				continue
+			}
+
+			req.sender.send(req.Reply("a", "Changed the password of " + chatId))
+
+		case ChangeNameRequestType:
+			name := req.args[0]
+
+			cm.mu.Lock()
+			_, err := setName.Exec(name, req.sender.username)
+			cm.mu.Unlock()
+			if err != nil {
+				log.Println("Error: Could not change name:", err)
+				req.sender.send(req.Error(ErrorCodeInternal, "An error occured"))
+				continue
+			}
+
+			req.sender.name = name
+			req.sender.send(req.Reply("a", "Your name is now " + name))
+			for _, chatId := range req.sender.chatIds() {
+				cm.broadcast(chatId, NewEvent(NameChangedEvent, chatId, NameChange{Username: req.sender.username, Name: name}), req.sender)
+			}
+
+		case ChangePasswordRequestType:
+			oldPassword, newPassword := req.args[0], req.args[1]
+
+			var nickname, hash string
+			cm.mu.RLock()
+			err := getUser.QueryRow(req.sender.username).Scan(&nickname, &hash)
+			cm.mu.RUnlock()
+			if err != nil {
+				log.Println("Error: Could not search for user", err)
+				req.sender.send(req.Error(ErrorCodeInternal, "An error occured"))
+				continue
+			}
+
+			ok, done := cm.checkPassword(req, hash, oldPassword)
+			if !done {
+				continue
+			}
+			if !ok {
+				req.sender.send(req.Error(ErrorCodeAuthFailed, "Wrong password"))
+				continue
+			}
+
+			newHash, done, err := cm.hashPassword(req, newPassword)
+			if !done {
+				continue
+			}
+			if err != nil {
+				req.sender.send(req.Error(ErrorCodeBadRequest, "Could not use password: " + err.Error()))
+				continue
+			}
+
+			cm.mu.Lock()
+			err = changePassword(db, req.sender.username, newHash, hashSessionToken(req.sender.token))
+			cm.mu.Unlock()
+			if err != nil {
+				log.Println("Error: Could not change password:", err)
+				req.sender.send(req.Error(ErrorCodeInternal, "An error occured"))
+				continue
+			}
+
+			for user := range cm.online[req.sender.username] {
+				if user != req.sender {
+					user.disconnect(NewMessage("n", "Your password was changed, log in again"))
+				}
+			}
+			req.sender.send(req.Reply("a", "Password changed, other sessions were revoked and other connections were logged out"))
+
+		case SendDirectRequestType:
+			username, content := req.args[0], req.args[1]
+
+			if username == req.sender.username {
+				req.sender.send(req.Error(ErrorCodeBadRequest, "You can't send direct messages to yourself"))
+				continue
+			}
+
+			chatId := directChatId(req.sender.username, username)
+			chat, ok := cm.chats[chatId]
+			if !ok {
+				var nickname, hash string
+				cm.mu.RLock()
+				err := getUser.QueryRow(username).Scan(&nickname, &hash)
+				cm.mu.RUnlock()
+				if err == sql.ErrNoRows {
+					req.sender.send(req.Error(ErrorCodeUserNotFound, "No such user " + username))
+					continue
+				} else if err != nil {
+					log.Println("Error: Could not search for user", err)
+					req.sender.send(req.Error(ErrorCodeInternal, "An error occured"))
+					continue
+				}
+
+				cm.mu.Lock()
+				err = createDirectChat(db, chatId, req.sender.username, username)
+				cm.mu.Unlock()
+				if err != nil {
+					log.Println("Error: Could not create direct chat:", err)
+					req.sender.send(req.Error(ErrorCodeInternal, "An error occured"))
+					continue
+				}
+
+				chat = NewChat(chatId, directChatName(req.sender.username, username), req.sender.username, false, cm.mu)
+				cm.chats[chatId] = chat
+				go chat.HandleRequests()
+
+				cm.connectOnline(req.sender.username, chat)
+				cm.connectOnline(username, chat)
+			} else if _, joined := req.sender.chat(chatId); !joined {
+				req.sender.send(req.Error(ErrorCodeNotAllowed, "Not a member of " + chatId))
+				continue
+			}
+
+			message := NewMessageRequest(content, req.sender)
+			message.requestId = req.requestId
+			chat.chatChan <- message
+
+		case CreateInviteRequestType:
+			chatId, duration := req.args[0], req.args[2]
+
+			maxUses, err := strconv.ParseInt(req.args[1], 10, 64)
+			if err != nil || maxUses < 0 {
+				req.sender.send(req.Error(ErrorCodeBadRequest, "Max uses must be a number, 0 for no limit"))
+				continue
+			}
+
+			expiresAt, err := parseExpiry(duration)
+			if err != nil {
+				req.sender.send(req.Error(ErrorCodeBadRequest, "Invalid invite duration, use " + PermanentBan + " or a duration such as 24h"))
+				continue
+			}
+
+			cm.mu.RLock()
+			role, err := getMemberRole(getRole, req.sender.username, chatId)
+			cm.mu.RUnlock()
+			if err != nil && err != sql.ErrNoRows {
+				log.Println("Error: Could not get role:", err)
+				req.sender.send(req.Error(ErrorCodeInternal, "An error occured"))
+				continue
+			}
+
+			if !CanPerform(role, InvitePermission) {
+				req.sender.send(req.Error(ErrorCodeNotAllowed, "Only admins of the chat can create invites"))
+				continue
+			}
+
+			code, err := newInviteCode()
+			if err != nil {
+				log.Println("Error: Could not generate invite code:", err)
+				req.sender.send(req.Error(ErrorCodeInternal, "An error occured"))
+				continue
+			}
+
+			var uses any
+			if maxUses > 0 {
+				uses = maxUses
+			}
+
+			cm.mu.Lock()
+			_, err = addInvite.Exec(code, chatId, req.sender.username, uses, expiresAt)
+			cm.mu.Unlock()
+			if err != nil {
+				log.Println("Error: Could not add invite:", err)
+				req.sender.send(req.Error(ErrorCodeInternal, "An error occured"))
+				continue
+			}
+
+			invite := Invite{Code: code, ChatId: chatId, MaxUses: maxUses}
+			if expiresAt != nil {
+				invite.ExpiresAt = expiresAt.(string)
+			}
+			req.sender.send(req.ReplyData("a", code, invite))
+
+		case JoinInviteRequestType:
+			code := req.args[0]
+
+			var chatId string
+			cm.mu.RLock()
+			err := getInvite.QueryRow(code).Scan(&chatId)
+			cm.mu.RUnlock()
+			if err == sql.ErrNoRows {
+				req.sender.send(req.Error(ErrorCodeInvalidInvite, "Invite code is invalid, expired or used up"))
+				continue
+			} else if err != nil {
+				log.Println("Error: Could not search for invite:", err)
+				req.sender.send(req.Error(ErrorCodeInternal, "An error occured"))
+				continue
+			}
+
+			ban := Removal{Username: req.sender.username}
+			cm.mu.RLock()
+			err = getBan.QueryRow(chatId, req.sender.username).Scan(&ban.By, &ban.Reason, &ban.ExpiresAt)
+			cm.mu.RUnlock()
+			if err == nil {
+				req.sender.send(req.ErrorData(ErrorCodeBanned, "You are banned from " + chatId, ban))
+				continue
+			} else if err != sql.ErrNoRows {
+				log.Println("Error: Could not search for ban:", err)
+				req.sender.send(req.Error(ErrorCodeInternal, "An error occured"))
+				continue
+			}
+
+			var joined int
+			cm.mu.RLock()
+			err = isJoined.QueryRow(req.sender.username, chatId).Scan(&joined)
+			cm.mu.RUnlock()
+			if err == nil {
+				req.sender.send(req.Error(ErrorCodeAlreadyJoined, "Already joined " + chatId))
+				continue
+			} else if err != sql.ErrNoRows {
+				log.Println("Error: Could not check if user joined chat:", err)
+				req.sender.send(req.Error(ErrorCodeInternal, "An error occured"))
+				continue
+			}
+
+			cm.mu.Lock()
+			ok, err := redeemInvite(db, code, req.sender.username, chatId)
+			cm.mu.Unlock()
+			if err != nil {
+				log.Println("Error: Could not redeem invite:", err)
+				req.sender.send(req.Error(ErrorCodeInternal, "An error occured"))
+				continue
+			}
+			if !ok {
+				req.sender.send(req.Error(ErrorCodeInvalidInvite, "Invite code is invalid, expired or used up"))
+				continue
 			}
+
+			req.sender.send(req.Reply("a", "Joined " + chatId))
+			cm.connectOnline(req.sender.username, cm.chats[chatId])
+
+		case RevokeInviteRequestType:
+			code := req.args[0]
+
+			var chatId string
+			cm.mu.RLock()
+			err := getInviteChat.QueryRow(code).Scan(&chatId)
+			cm.mu.RUnlock()
+			if err == sql.ErrNoRows {
+				req.sender.send(req.Error(ErrorCodeInvalidInvite, "No such invite"))
+				continue
+			} else if err != nil {
+				log.Println("Error: Could not search for invite:", err)
+				req.sender.send(req.Error(ErrorCodeInternal, "An error occured"))
+				continue
+			}
+
+			cm.mu.RLock()
+			role, err := getMemberRole(getRole, req.sender.username, chatId)
+			cm.mu.RUnlock()
+			if err != nil && err != sql.ErrNoRows {
+				log.Println("Error: Could not get role:", err)
+				req.sender.send(req.Error(ErrorCodeInternal, "An error occured"))
+				continue
+			}
+
+			if !CanPerform(role, InvitePermission) {
+				req.sender.send(req.Error(ErrorCodeNotAllowed, "Only admins of the chat can revoke invites"))
+				continue
+			}
+
+			cm.mu.Lock()
+			_, err = deleteInvite.Exec(code)
+			cm.mu.Unlock()
+			if err != nil {
+				log.Println("Error: Could not revoke invite:", err)
+				req.sender.send(req.Error(ErrorCodeInternal, "An error occured"))
+				continue
+			}
+			req.sender.send(req.Reply("a", "Revoked invite to " + chatId))
+
+		case SetVisibilityRequestType:
+			chatId, visibility := req.args[0], req.args[1]
+
+			cm.mu.RLock()
+			role, err := getMemberRole(getRole, req.sender.username, chatId)
+			cm.mu.RUnlock()
+			if err != nil && err != sql.ErrNoRows {
+				log.Println("Error: Could not get role:", err)
+				req.sender.send(req.Error(ErrorCodeInternal, "An error occured"))
+				continue
+			}
+
+			if !CanPerform(role, SetVisibilityPermission) {
+				req.sender.send(req.Error(ErrorCodeNotAllowed, "Only admins of the chat can change its visibility"))
+				continue
+			}
+
+			cm.mu.Lock()
+			_, err = setVisibility.Exec(visibility, chatId)
+			cm.mu.Unlock()
+			if err != nil {
+				log.Println("Error: Could not set visibility:", err)
+				req.sender.send(req.Error(ErrorCodeInternal, "An error occured"))
+				continue
+			}
+
+			cm.chats[chatId].public = visibility == VisibilityPublic
+			req.sender.send(req.Reply("a", chatId + " is now " + visibility))
+
+		case SearchChatsRequestType:
+			query := req.args[0]
+
+			var err error
+			results := make(ChatSearchResults, 0)
+			for _, chat := range cm.searchChats(query) {
+				result := ChatSearchResult{ChatId: chat.chatId, ChatName: chat.chatName}
+				cm.mu.RLock()
+				err = getMemberCount.QueryRow(chat.chatId).Scan(&result.MemberCount)
+				cm.mu.RUnlock()
+				if err != nil {
+					break
+				}
+				results = append(results, result)
+			}
+			if err != nil {
+				log.Println("Error: Could not count members:", err)
+				req.sender.send(req.Error(ErrorCodeInternal, "An error occured"))
+				continue
+			}
+			req.sender.send(req.ReplyData("a", strconv.Itoa(len(results)), results))
+
+		case QuitRequestType:
+			cm.disconnect(req.sender)
+
+		case GetChatsRequestType:
+			cm.mu.RLock()
+			rows, err := getChatSummaries.Query(req.sender.username)
+			cm.mu.RUnlock()
+			if err != nil {
+				log.Println("Error: Could not query chats:", err)
+				req.sender.send(req.Error(ErrorCodeInternal, "An error occured"))
+				continue
+			}
+
+			chats, err := scanChatSummaries(rows)
+			if err != nil {
+				log.Println("Error: Could not read chats:", err)
+				req.sender.send(req.Error(ErrorCodeInternal, "An error occured"))
+				continue
+			}
+			req.sender.send(req.ReplyData("a", strconv.Itoa(len(chats)), chats))
+
+		default:
+			req.sender.send(req.Error(ErrorCodeUnknownRequest, "Unknown request " + req.string))
 		}
 	}
 }
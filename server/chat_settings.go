@@ -0,0 +1,11 @@
+package server
+
+// ChatRename is the data of a ChatRenamedEvent.
+type ChatRename struct {
+	ChatName string		`json:"chat_name"`
+	RenamedBy string	`json:"renamed_by"`
+}
+
+func (r ChatRename) String() string {
+	return r.RenamedBy + " " + textEscaper.Replace(r.ChatName)
+}
@@ -0,0 +1,89 @@
+package server
+
+import (
+	"database/sql"
+	"strconv"
+	"strings"
+)
+
+// The maximum number of characters of the last message shown in a chat summary.
+const MessagePreviewLength int = 100
+
+// ChatSummary is a chat a user has joined as it is shown in the chats list of the user.
+type ChatSummary struct {
+	ChatId string					`json:"chat_id"`
+	ChatName string					`json:"chat_name"`
+	Owner string					`json:"owner"`
+	Kind string						`json:"kind"`			// ChatKindGroup or ChatKindDirect, the ids of direct chats also start with DirectChatPrefix.
+	MemberCount int64				`json:"member_count"`
+	Unread int64					`json:"unread"`		// the number of messages by other users after the read marker of the user.
+	LastMessage *StoredMessage		`json:"last_message,omitempty"`	// a preview of the last message, nil if the chat has no messages.
+}
+
+// The first line is "chatId owner kind memberCount unread chatName".
+// if the chat has messages, the preview of the last message is on the next line indented by two spaces.
+func (c ChatSummary) String() string {
+	summary := c.ChatId + " " + c.Owner + " " + c.Kind + " " + strconv.FormatInt(c.MemberCount, 10) + " " + strconv.FormatInt(c.Unread, 10) + " " + textEscaper.Replace(c.ChatName)
+	if c.LastMessage != nil {
+		summary += "\n  " + c.LastMessage.String()
+	}
+	return summary
+}
+
+// ChatList is the list of chats a user has joined ordered by when they were joined.
+type ChatList []ChatSummary
+
+func (l ChatList) String() string {
+	lines := make([]string, len(l))
+	for i, chat := range l {
+		lines[i] = chat.String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// The query of the summaries of the chats a user has joined, it takes the username.
+const chatSummariesQuery string = `
+	SELECT chats.chatId, chats.chatName, chats.owner, chats.kind,
+		(SELECT COUNT(*) FROM joined AS members WHERE members.chatId = chats.chatId),
+		(SELECT COUNT(*) FROM messages WHERE messages.chatId = chats.chatId and messages.id > COALESCE(read_markers.lastReadId, 0) and messages.username != joined.username),
+		last.id, last.username, last.date, last.content
+	FROM joined
+	JOIN chats ON chats.chatId = joined.chatId
+	LEFT JOIN read_markers ON read_markers.username = joined.username and read_markers.chatId = joined.chatId
+	LEFT JOIN messages AS last ON last.id = (SELECT MAX(id) FROM messages WHERE messages.chatId = chats.chatId)
+	WHERE joined.username = ?
+	ORDER BY joined.id
+`
+
+// Reads the chat summaries from rows of the chatSummariesQuery.
+func scanChatSummaries(rows *sql.Rows) (ChatList, error) {
+	defer rows.Close()
+
+	chats := make(ChatList, 0)
+	for rows.Next() {
+		var chat ChatSummary
+		var lastId sql.NullInt64
+		var lastUsername, lastDate, lastContent sql.NullString
+
+		err := rows.Scan(&chat.ChatId, &chat.ChatName, &chat.Owner, &chat.Kind, &chat.MemberCount, &chat.Unread, &lastId, &lastUsername, &lastDate, &lastContent)
+		if err != nil {
+			return nil, err
+		}
+
+		if lastId.Valid {
+			preview := []rune(lastContent.String)
+			if len(preview) > MessagePreviewLength {
+				preview = preview[:MessagePreviewLength]
+			}
+			chat.LastMessage = &StoredMessage{
+				Id: lastId.Int64,
+				ChatId: chat.ChatId,
+				Username: lastUsername.String,
+				Date: lastDate.String,
+				Content: string(preview),
+			}
+		}
+		chats = append(chats, chat)
+	}
+	return chats, rows.Err()
+}
@@ -8,22 +8,51 @@ type ClientRequest struct {
 	//	server manager related.
 	//		"li": "login"
 	//		"lo": "logout"
+	//		"rs": "resume session"
 	//		"nu": "new user"
 	//		"du": "delete user"
 	//		"jo": "join chat"
 	//		"le": "leave chat"
 	//		"nc": "new chat"
 	//		"dc": "delete chat"
-	//		"gc": "get connected chats"		unimplemented
+	//		"gc": "get joined chats"
+	//		"sr": "set role"
+	//		"ki": "kick member"
+	//		"ba": "ban user"
+	//		"ub": "unban user"
+	//		"to": "transfer ownership"
+	//		"rn": "rename chat"
+	//		"cp": "change chat password"
+	//		"cn": "change name"
+	//		"pw": "change password"
+	//		"sd": "send direct message"
+	//		"ci": "create invite"
+	//		"ji": "join by invite"
+	//		"ri": "revoke invite"
+	//		"sv": "set chat visibility"
+	//		"sc": "search public chats"
 	//		"qu": "quit"
 	//	chat related.
 	//		"nm": "new message"
-	//		"dm": "delete message"			unimplemented
-	//		"gm": "get chat messages"		unimplemented
-	//		"gu": "get connected users"		unimplemented
+	//		"rp": "reply to message"
+	//		"dm": "delete message"
+	//		"em": "edit message"
+	//		"gm": "get chat messages"
+	//		"gt": "get thread"
+	//		"gu": "get chat members"
+	//		"mr": "mark read"
+	//		"ar": "add reaction"
+	//		"rr": "remove reaction"
+	//		"pi": "pin message"
+	//		"up": "unpin message"
+	//		"lp": "list pinned messages"
 	string
-	content string	// the content of the request.
-	sender *User	// a pointer to the user who sent the request.
+	requestId string	// an id chosen by the client, it is sent back with every reply to the request.
+	args []string		// the arguments of the request, they depend on the type of the request.
+	sender *User		// a pointer to the user who sent the request.
+	message Message		// the message an internal request carries, e.g. an event to broadcast.
+	check *passwordCheck	// the result of checking a password off the server manager goroutine, nil until it is checked.
+	hashed *passwordHash	// the result of hashing a password off the server manager goroutine, nil until it is hashed.
 }
 
 const (
@@ -31,6 +60,8 @@ const (
 	LoginRequestType  string		= "li"
 	// A requset to log out from a user.
 	LogoutRequestType string		= "lo"
+	// A request to log in to an existing user with the token of a session instead of the password.
+	ResumeRequestType string		= "rs"
 	// A request to create a new user.
 	NewUserRequestType string		= "nu"
 	// A request to delete an existing user.
@@ -47,97 +78,330 @@ const (
 	GetChatsRequestType string 		= "gc"
 	// A request from a user to quit
 	QuitRequestType string			= "qu"
+	// A request from an admin or the owner of a chat to promote or demote a member of the chat.
+	SetRoleRequestType string		= "sr"
+	// A request from a moderator of a chat to remove a member from the chat.
+	KickRequestType string			= "ki"
+	// A request from an admin of a chat to remove a user from the chat and stop them from joining it again.
+	BanRequestType string			= "ba"
+	// A request from an admin of a chat to let a banned user join the chat again.
+	UnbanRequestType string			= "ub"
+	// A request from the owner of a chat to make another member the owner.
+	TransferOwnershipRequestType string	= "to"
+	// A request from an admin of a chat to change the name of the chat.
+	RenameChatRequestType string	= "rn"
+	// A request from an admin of a chat to change the password needed to join the chat.
+	ChangeChatPasswordRequestType string	= "cp"
+	// A request from a user to change their name.
+	ChangeNameRequestType string	= "cn"
+	// A request from a user to change their password, the old password is needed.
+	ChangePasswordRequestType string	= "pw"
+	// A request from a user to send a message to another user, the direct chat between them is created by the first message.
+	SendDirectRequestType string	= "sd"
+	// A request from an admin of a chat to create an invite code to the chat.
+	CreateInviteRequestType string	= "ci"
+	// A request from a user to join a chat with an invite code instead of the password of the chat.
+	JoinInviteRequestType string	= "ji"
+	// A request from an admin of a chat to revoke an invite code to the chat.
+	RevokeInviteRequestType string	= "ri"
+	// A request from an admin of a chat to make the chat public or private.
+	SetVisibilityRequestType string	= "sv"
+	// A request from a user to search for public chats by their ids and names.
+	SearchChatsRequestType string	= "sc"
 
 	// A request to send a new message from a user in a chat to all members in that chat.
 	NewMessageRequestType string 	= "nm"
+	// A request to send a new message that replies to another message in the same chat.
+	ReplyRequestType string			= "rp"
 	// A request from a user to delete an existing message in a chat.
 	DeleteMessageRequestType string	= "dm"
+	// A request from the author of a message in a chat to change its content.
+	EditMessageRequestType string	= "em"
 	// A request from a user to send stored messages to the user.
 	GetMessagesRequestType string  	= "gm"
-	// A request from a user to send all other users who joined the chat.
+	// A request from a user to send a message and all of the replies under it.
+	GetThreadRequestType string		= "gt"
+	// A request from a user to send all users who joined the chat and whether they are connected.
 	GetUsersRequestType string     	= "gu"
+	// A request from a user to mark the messages in a chat up to a message as read.
+	MarkReadRequestType string		= "mr"
+	// A request from a user to react to a message in a chat with an emoji.
+	AddReactionRequestType string	= "ar"
+	// A request from a user to remove their reaction with an emoji to a message in a chat.
+	RemoveReactionRequestType string	= "rr"
+	// A request from an admin of a chat to pin a message in the chat.
+	PinMessageRequestType string	= "pi"
+	// A request from an admin of a chat to unpin a message in the chat.
+	UnpinMessageRequestType string	= "up"
+	// A request from a user to send the pinned messages of a chat.
+	GetPinsRequestType string		= "lp"
 )
 
-func NewClientRequest(request string, data string, user *User) ClientRequest {
+// The types of internal requests, they are sent by the server manager to a chat so that only the goroutine of the chat changes its connected users.
+// clients can't send them since they aren't two letters long.
+const (
+	// A request to a chat to add a user to the users connected to the chat.
+	ConnectRequestType string		= "connect"
+	// A request to a chat to remove every user logged in to a username from the users connected to the chat.
+	// the message of the request is sent to the removed users and to the rest of the chat, unless it is empty.
+	DisconnectRequestType string	= "disconnect"
+	// A request to a chat to send the message of the request to the users connected to the chat, except the sender of the request if it isn't nil.
+	BroadcastRequestType string		= "broadcast"
+)
+
+func NewClientRequest(request string, args []string, user *User) ClientRequest {
 	return ClientRequest{
 		string: request,
-		content: data,
+		args: args,
 		sender: user,
 	}
 }
 
+// Creates a reply to the request that carries the id of the request.
+func (req ClientRequest) Reply(message string, content string) Message {
+	reply := NewMessage(message, content)
+	reply.requestId = req.requestId
+	return reply
+}
+
+// Creates a reply to the request that carries the id of the request and structured data.
+func (req ClientRequest) ReplyData(message string, content string, data any) Message {
+	reply := NewDataMessage(message, content, data)
+	reply.requestId = req.requestId
+	return reply
+}
+
+// Creates an error reply to the request with one of the error codes.
+func (req ClientRequest) Error(code string, content string) Message {
+	reply := NewErrorMessage(code, content)
+	reply.requestId = req.requestId
+	return reply
+}
+
+// Creates an error reply to the request with one of the error codes and structured data about the error.
+func (req ClientRequest) ErrorData(code string, content string, data any) Message {
+	reply := req.Error(code, content)
+	reply.data = data
+	return reply
+}
+
 // Creates a client request of the type LoginRequestType("li")
 func LoginRequest(username string, password string, user *User) ClientRequest {
-	req_content := strings.TrimSpace(username) + " " + strings.TrimSpace(password)
-	return NewClientRequest(LoginRequestType, req_content, user)
+	return NewClientRequest(LoginRequestType, []string{strings.TrimSpace(username), password}, user)
 }
 
 // Creates a client request of the type LogoutRequestType("lo")
 func LogoutRequest(user *User) ClientRequest {
-	return NewClientRequest(LogoutRequestType, user.username, user)
+	return NewClientRequest(LogoutRequestType, []string{user.username, user.token}, user)
+}
+
+// Creates a client request of the type ResumeRequestType("rs")
+func ResumeRequest(token string, user *User) ClientRequest {
+	return NewClientRequest(ResumeRequestType, []string{strings.TrimSpace(token)}, user)
 }
 
 // Creates a client request of the type NewUserRequestType("nu")
 func NewUserRequest(username string, name string, password string, user *User) ClientRequest {
-	reqContent := strings.Join([]string{username, name, password}, " ")
-	return NewClientRequest(NewUserRequestType, reqContent, user)
+	return NewClientRequest(NewUserRequestType, []string{username, name, password}, user)
 }
 
 // Creates a client request of the type DeleteUserRequestType("du")
 func DeleteUserRequest(password string, user *User) ClientRequest {
-	return NewClientRequest(DeleteUserRequestType, password, user)
+	return NewClientRequest(DeleteUserRequestType, []string{password}, user)
 }
 
 // Creates a client request of the type JoinChatRequestType("jo")
 func JoinChatRequest(chatId string, chatPassword string, user *User) ClientRequest {
-	reqContent := strings.Join([]string{chatId, chatPassword}, " ")
-	return NewClientRequest(JoinChatRequestType, reqContent, user)
+	return NewClientRequest(JoinChatRequestType, []string{chatId, chatPassword}, user)
 }
 
 // Creates a client request of the type LeaveChatRequestType("le")
 func LeaveChatRequest(chatId string, user *User) ClientRequest {
-	return NewClientRequest(LeaveChatRequestType, chatId, user)
+	return NewClientRequest(LeaveChatRequestType, []string{chatId}, user)
 }
 
 // Creates a client request of the type NewChatRequestType("nc")
 func NewChatRequest(chatId string, chatName string, chatPassword string, user *User) ClientRequest {
-	reqContent := strings.Join([]string{chatId, chatName, chatPassword}, " ")
-	return NewClientRequest(NewChatRequestType, reqContent, user)
+	return NewClientRequest(NewChatRequestType, []string{chatId, chatName, chatPassword}, user)
 }
 
 // Creates a client request of the type DeleteChatRequestType("dc")
 func DeleteChatRequest(chatId string, chatPassword string, user *User) ClientRequest {
-	reqContent := strings.Join([]string{chatId, chatPassword}, " ")
-	return NewClientRequest(DeleteChatRequestType, reqContent, user)
+	return NewClientRequest(DeleteChatRequestType, []string{chatId, chatPassword}, user)
 }
 
 //Creates a client request of the type GetChatsRequestType("gc")
 func GetChatsRequest(user *User) ClientRequest {
-	return NewClientRequest(GetChatsRequestType, user.username, user)
+	return NewClientRequest(GetChatsRequestType, []string{user.username}, user)
+}
+
+// Creates a client request of the type SetRoleRequestType("sr")
+func SetRoleRequest(chatId string, username string, role string, user *User) ClientRequest {
+	return NewClientRequest(SetRoleRequestType, []string{chatId, username, strings.ToLower(role)}, user)
+}
+
+// Creates a client request of the type KickRequestType("ki")
+func KickRequest(chatId string, username string, user *User) ClientRequest {
+	return NewClientRequest(KickRequestType, []string{chatId, username}, user)
+}
+
+// Creates a client request of the type BanRequestType("ba")
+// the duration is PermanentBan or a duration such as "24h".
+func BanRequest(chatId string, username string, duration string, reason string, user *User) ClientRequest {
+	return NewClientRequest(BanRequestType, []string{chatId, username, duration, reason}, user)
+}
+
+// Creates a client request of the type UnbanRequestType("ub")
+func UnbanRequest(chatId string, username string, user *User) ClientRequest {
+	return NewClientRequest(UnbanRequestType, []string{chatId, username}, user)
+}
+
+// Creates a client request of the type TransferOwnershipRequestType("to")
+func TransferOwnershipRequest(chatId string, newOwner string, user *User) ClientRequest {
+	return NewClientRequest(TransferOwnershipRequestType, []string{chatId, newOwner}, user)
+}
+
+// Creates a client request of the type RenameChatRequestType("rn")
+func RenameChatRequest(chatId string, chatName string, user *User) ClientRequest {
+	return NewClientRequest(RenameChatRequestType, []string{chatId, chatName}, user)
+}
+
+// Creates a client request of the type ChangeChatPasswordRequestType("cp")
+func ChangeChatPasswordRequest(chatId string, chatPassword string, user *User) ClientRequest {
+	return NewClientRequest(ChangeChatPasswordRequestType, []string{chatId, chatPassword}, user)
+}
+
+// Creates a client request of the type ChangeNameRequestType("cn")
+func ChangeNameRequest(name string, user *User) ClientRequest {
+	return NewClientRequest(ChangeNameRequestType, []string{name}, user)
+}
+
+// Creates a client request of the type ChangePasswordRequestType("pw")
+func ChangePasswordRequest(oldPassword string, newPassword string, user *User) ClientRequest {
+	return NewClientRequest(ChangePasswordRequestType, []string{oldPassword, newPassword}, user)
+}
+
+// Creates a client request of the type SendDirectRequestType("sd")
+func SendDirectRequest(username string, content string, user *User) ClientRequest {
+	return NewClientRequest(SendDirectRequestType, []string{username, content}, user)
+}
+
+// Creates a client request of the type CreateInviteRequestType("ci")
+func CreateInviteRequest(chatId string, maxUses string, duration string, user *User) ClientRequest {
+	return NewClientRequest(CreateInviteRequestType, []string{chatId, maxUses, duration}, user)
+}
+
+// Creates a client request of the type JoinInviteRequestType("ji")
+func JoinInviteRequest(code string, user *User) ClientRequest {
+	return NewClientRequest(JoinInviteRequestType, []string{code}, user)
+}
+
+// Creates a client request of the type RevokeInviteRequestType("ri")
+func RevokeInviteRequest(code string, user *User) ClientRequest {
+	return NewClientRequest(RevokeInviteRequestType, []string{code}, user)
+}
+
+// Creates a client request of the type SetVisibilityRequestType("sv")
+func SetVisibilityRequest(chatId string, visibility string, user *User) ClientRequest {
+	return NewClientRequest(SetVisibilityRequestType, []string{chatId, visibility}, user)
+}
+
+// Creates a client request of the type SearchChatsRequestType("sc")
+func SearchChatsRequest(query string, user *User) ClientRequest {
+	return NewClientRequest(SearchChatsRequestType, []string{query}, user)
 }
 
 // Creates a client request of the type QuitRequestType("qu")
 func QuitRequest(user *User) ClientRequest {
-	return NewClientRequest(QuitRequestType, user.username, user)
+	return NewClientRequest(QuitRequestType, []string{user.username}, user)
 }
 
 
 // Creates a client request of the type NewMessageRequestType("nm")
 func NewMessageRequest(content string, user *User) ClientRequest {
-	return NewClientRequest(NewMessageRequestType, content, user)
+	return NewClientRequest(NewMessageRequestType, []string{content}, user)
 }
 
 // Creates a client request of the type DeleteMessageRequestType("dm")
 func DeleteMessageRequest(messageId string, user *User) ClientRequest {
-	return NewClientRequest(DeleteMessageRequestType, messageId, user)
+	return NewClientRequest(DeleteMessageRequestType, []string{messageId}, user)
 }
 
-// Creates a client request of the type GetMessagesRequestType("gm")
+// Creates a client request of the type ReplyRequestType("rp")
+func ReplyRequest(parentId string, content string, user *User) ClientRequest {
+	return NewClientRequest(ReplyRequestType, []string{content, parentId}, user)
+}
+
+// Creates a client request of the type GetThreadRequestType("gt") for the messages of a thread after an id, "0" for the whole thread.
+func GetThreadRequest(rootId string, afterMessageId string, user *User) ClientRequest {
+	return NewClientRequest(GetThreadRequestType, []string{rootId, afterMessageId}, user)
+}
+
+// Creates a client request of the type EditMessageRequestType("em")
+func EditMessageRequest(messageId string, content string, user *User) ClientRequest {
+	return NewClientRequest(EditMessageRequestType, []string{messageId, content}, user)
+}
+
+// Creates a client request of the type GetMessagesRequestType("gm") for the messages from an id to another id.
 func GetMessagesRequest(fromMessageId string, toMessageId string, user *User) ClientRequest {
-	return NewClientRequest(GetMessagesRequestType, strings.Join([]string{fromMessageId, toMessageId}, " "), user)
+	return NewClientRequest(GetMessagesRequestType, []string{MessagesRangeMode, fromMessageId, toMessageId}, user)
+}
+
+// Creates a client request of the type GetMessagesRequestType("gm") for up to limit messages before an id.
+func GetMessagesBeforeRequest(beforeMessageId string, limit string, user *User) ClientRequest {
+	return NewClientRequest(GetMessagesRequestType, []string{MessagesBeforeMode, beforeMessageId, limit}, user)
 }
 
 // Creates a client request of the type GetUsersRequestType("gu")
 func GetUsersRequest(user *User) ClientRequest {
-	return NewClientRequest(GetUsersRequestType, user.username, user)
+	return NewClientRequest(GetUsersRequestType, []string{user.username}, user)
+}
+
+// Creates a client request of the type MarkReadRequestType("mr")
+func MarkReadRequest(messageId string, user *User) ClientRequest {
+	return NewClientRequest(MarkReadRequestType, []string{messageId}, user)
+}
+
+// Creates a client request of the type AddReactionRequestType("ar")
+func AddReactionRequest(messageId string, emoji string, user *User) ClientRequest {
+	return NewClientRequest(AddReactionRequestType, []string{messageId, emoji}, user)
+}
+
+// Creates a client request of the type RemoveReactionRequestType("rr")
+func RemoveReactionRequest(messageId string, emoji string, user *User) ClientRequest {
+	return NewClientRequest(RemoveReactionRequestType, []string{messageId, emoji}, user)
+}
+
+// Creates a client request of the type PinMessageRequestType("pi")
+func PinMessageRequest(messageId string, user *User) ClientRequest {
+	return NewClientRequest(PinMessageRequestType, []string{messageId}, user)
+}
+
+// Creates a client request of the type UnpinMessageRequestType("up")
+func UnpinMessageRequest(messageId string, user *User) ClientRequest {
+	return NewClientRequest(UnpinMessageRequestType, []string{messageId}, user)
+}
+
+// Creates a client request of the type GetPinsRequestType("lp") for the pinned messages after a pinned message, "0" for all of them.
+func GetPinsRequest(afterMessageId string, user *User) ClientRequest {
+	return NewClientRequest(GetPinsRequestType, []string{afterMessageId}, user)
+}
+
+// Creates an internal request of the type ConnectRequestType("connect")
+func ConnectRequest(username string, user *User) ClientRequest {
+	return NewClientRequest(ConnectRequestType, []string{username}, user)
+}
+
+// Creates an internal request of the type DisconnectRequestType("disconnect")
+func DisconnectRequest(username string, message Message) ClientRequest {
+	req := NewClientRequest(DisconnectRequestType, []string{username}, nil)
+	req.message = message
+	return req
+}
+
+// Creates an internal request of the type BroadcastRequestType("broadcast")
+func BroadcastRequest(message Message, user *User) ClientRequest {
+	req := NewClientRequest(BroadcastRequestType, []string{}, user)
+	req.message = message
+	return req
 }
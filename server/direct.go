@@ -0,0 +1,106 @@
+package server
+
+import (
+	"database/sql"
+	"strconv"
+	"strings"
+)
+
+// The kinds of chats.
+const (
+	// A chat created with a chat id and a password that users join.
+	ChatKindGroup string	= "group"
+	// A chat between two users that is created when one of them sends the first direct message.
+	ChatKindDirect string	= "direct"
+)
+
+// The prefix of the ids of direct chats, group chats can't have ids starting with it.
+const DirectChatPrefix string = "dm:"
+
+// Gets the id of the direct chat between two users, it is the same for both orders of the usernames.
+// the length of the first username comes before the usernames, so usernames with ":" in them can't make the same id as other usernames.
+func directChatId(username string, other string) string {
+	if other < username {
+		username, other = other, username
+	}
+	return DirectChatPrefix + strconv.Itoa(len(username)) + ":" + username + ":" + other
+}
+
+// Gets the name of the direct chat between two users.
+func directChatName(username string, other string) string {
+	if other < username {
+		username, other = other, username
+	}
+	return username + " & " + other
+}
+
+// Creates a direct chat between two users in the database and joins both of them to it as members.
+// direct chats have no password, only their two members can send messages to them.
+func createDirectChat(db *sql.DB, chatId string, username string, other string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("INSERT INTO chats (chatId, chatName, password, owner, kind) VALUES (?, ?, '', ?, ?)", chatId, directChatName(username, other), username, ChatKindDirect)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("INSERT INTO joined (username, chatId, role) VALUES (?, ?, ?), (?, ?, ?)", username, chatId, RoleMember, other, chatId, RoleMember)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Deletes a user and the direct chats they are a member of from the database.
+// returns the result of deleting the user and the ids of the deleted direct chats.
+func deleteUserAndDirectChats(db *sql.DB, username string) (sql.Result, []string, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query("SELECT chats.chatId FROM chats JOIN joined ON joined.chatId = chats.chatId WHERE chats.kind = ? and joined.username = ?", ChatKindDirect, username)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	chatIds := make([]string, 0)
+	for rows.Next() {
+		var chatId string
+		err := rows.Scan(&chatId)
+		if err != nil {
+			rows.Close()
+			return nil, nil, err
+		}
+		chatIds = append(chatIds, chatId)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	for _, chatId := range chatIds {
+		_, err = tx.Exec("DELETE FROM chats WHERE chatId = ?", chatId)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	res, err := tx.Exec("DELETE FROM users where username = ?", username)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return res, chatIds, tx.Commit()
+}
+
+// Checks whether a chat id is reserved for direct chats.
+func isDirectChatId(chatId string) bool {
+	return strings.HasPrefix(chatId, DirectChatPrefix)
+}
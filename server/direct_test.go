@@ -0,0 +1,50 @@
+package server
+
+import "testing"
+
+func TestDirectChatId(t *testing.T) {
+	tests := []struct {
+		username string
+		other string
+		want string
+	}{
+		{"alice", "bob", "dm:5:alice:bob"},
+		{"bob", "alice", "dm:5:alice:bob"},
+		{"a:b", "c", "dm:3:a:b:c"},
+		{"a", "b:c", "dm:1:a:b:c"},
+	}
+	for _, test := range tests {
+		got := directChatId(test.username, test.other)
+		if got != test.want {
+			t.Errorf("directChatId(%q, %q) = %q, want %q", test.username, test.other, got, test.want)
+		}
+		if !isDirectChatId(got) {
+			t.Errorf("isDirectChatId(%q) = false, want true", got)
+		}
+	}
+}
+
+func TestDirectChatIdCollision(t *testing.T) {
+	pairs := [][2]string{
+		{"a:b", "c"},
+		{"a", "b:c"},
+		{"a:", "b"},
+		{"a", ":b"},
+		{"1:a", "b"},
+	}
+	ids := make(map[string][2]string)
+	for _, pair := range pairs {
+		id := directChatId(pair[0], pair[1])
+		if previous, ok := ids[id]; ok {
+			t.Errorf("%q and %q both have the id %q", previous, pair, id)
+		}
+		ids[id] = pair
+	}
+}
+
+func TestChatSummaryStringHasKind(t *testing.T) {
+	summary := ChatSummary{ChatId: "dm:5:alice:bob", ChatName: "alice, bob", Owner: "alice", Kind: ChatKindDirect, MemberCount: 2, Unread: 1}
+	if got, want := summary.String(), "dm:5:alice:bob alice direct 2 1 alice, bob"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,26 @@
+package server
+
+import "database/sql"
+
+// Replaces the content of a message and stores its previous content in the message_edits table.
+// returns the date of the edit.
+func editMessage(db *sql.DB, messageId int64, chatId string, content string) (string, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("INSERT INTO message_edits (messageId, content) SELECT id, content FROM messages WHERE id = ? and chatId = ?", messageId, chatId)
+	if err != nil {
+		return "", err
+	}
+
+	var editedAt string
+	err = tx.QueryRow("UPDATE messages SET content = ?, edited_at = datetime('now') WHERE id = ? and chatId = ? RETURNING edited_at", content, messageId, chatId).Scan(&editedAt)
+	if err != nil {
+		return "", err
+	}
+
+	return editedAt, tx.Commit()
+}
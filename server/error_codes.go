@@ -0,0 +1,66 @@
+package server
+
+// The error codes that are sent with every error message ("e") so clients can react to errors without parsing the text.
+const (
+	// The request is missing arguments or its arguments are malformed.
+	ErrorCodeBadRequest string			= "BAD_REQUEST"
+	// The request type is unknown or not implemented.
+	ErrorCodeUnknownRequest string		= "UNKNOWN_REQUEST"
+	// The JSON protocol version is not supported or the hello is invalid.
+	ErrorCodeUnsupportedProtocol string	= "UNSUPPORTED_PROTOCOL"
+	// The request is bigger than the maximum frame size, the client is disconnected after this error.
+	ErrorCodeRequestTooLarge string		= "REQUEST_TOO_LARGE"
+	// The message to the client is bigger than the maximum frame size, or a message sent to a chat would not fit in the frames about it.
+	ErrorCodeMessageTooLarge string		= "MESSAGE_TOO_LARGE"
+	// The request needs the user to be logged in.
+	ErrorCodeNotLoggedIn string			= "NOT_LOGGED_IN"
+	// The request needs the user to be logged out.
+	ErrorCodeAlreadyLoggedIn string		= "ALREADY_LOGGED_IN"
+	// The username or password (of a user or a chat) is wrong.
+	ErrorCodeAuthFailed string			= "AUTH_FAILED"
+	// The username is used by another user.
+	ErrorCodeUsernameTaken string		= "USERNAME_TAKEN"
+	// The chat does not exist.
+	ErrorCodeChatNotFound string		= "CHAT_NOT_FOUND"
+	// The chat id is used by another chat.
+	ErrorCodeChatIdTaken string			= "CHAT_ID_TAKEN"
+	// The request can only be done by the owner of the chat.
+	ErrorCodeNotOwner string			= "NOT_OWNER"
+	// The request can't be done by the owner of a chat, the ownership has to be transferred or the chat deleted first.
+	ErrorCodeIsOwner string				= "IS_OWNER"
+	// The user is not allowed to do the request, e.g. deleting a message of another user.
+	ErrorCodeNotAllowed string			= "NOT_ALLOWED"
+	// The message does not exist in the chat.
+	ErrorCodeMessageNotFound string		= "MESSAGE_NOT_FOUND"
+	// The user does not exist.
+	ErrorCodeUserNotFound string		= "USER_NOT_FOUND"
+	// The user is banned from the chat.
+	ErrorCodeBanned string				= "BANNED"
+	// The user is not banned from the chat.
+	ErrorCodeNotBanned string			= "NOT_BANNED"
+	// The user has already joined the chat.
+	ErrorCodeAlreadyJoined string		= "ALREADY_JOINED"
+	// The user has not joined the chat.
+	ErrorCodeNotJoined string			= "NOT_JOINED"
+	// The invite code does not exist, expired or was used up.
+	ErrorCodeInvalidInvite string		= "INVALID_INVITE"
+	// The chat has the maximum number of pinned messages.
+	ErrorCodePinLimit string			= "PIN_LIMIT"
+	// Something went wrong on the server.
+	ErrorCodeInternal string			= "INTERNAL_ERROR"
+)
+
+// CodedError is an error that is sent to the client with its error code.
+type CodedError struct {
+	Code string	// one of the error codes.
+	Text string	// the text of the error.
+}
+
+func (e CodedError) Error() string {
+	return e.Text
+}
+
+// Creates a coded error with the code ErrorCodeBadRequest.
+func badRequest(text string) error {
+	return CodedError{Code: ErrorCodeBadRequest, Text: text}
+}
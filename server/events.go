@@ -0,0 +1,71 @@
+package server
+
+import "strconv"
+
+// The type of the messages that tell the members of a chat that something happened in the chat.
+// the content of an event is its name followed by the chat id, e.g. "message_deleted general".
+const EventMessageType string = "v"
+
+const (
+	// A message in the chat got deleted.
+	MessageDeletedEvent string	= "message_deleted"
+	// A member of the chat has read the messages up to a message.
+	MessageReadEvent string		= "message_read"
+	// The role of a member of the chat got changed.
+	RoleChangedEvent string		= "role_changed"
+	// A member got kicked from the chat.
+	MemberKickedEvent string	= "member_kicked"
+	// A user got banned from the chat.
+	MemberBannedEvent string	= "member_banned"
+	// The owner of the chat changed.
+	OwnerChangedEvent string	= "owner_changed"
+	// The chat got a new name.
+	ChatRenamedEvent string		= "chat_renamed"
+	// A member of the chat changed their name.
+	NameChangedEvent string		= "name_changed"
+	// A message in the chat got edited by its author.
+	MessageEditedEvent string	= "message_edited"
+	// A member of the chat reacted to a message.
+	ReactionAddedEvent string	= "reaction_added"
+	// A member of the chat removed their reaction to a message.
+	ReactionRemovedEvent string	= "reaction_removed"
+	// A message in the chat got pinned.
+	MessagePinnedEvent string	= "message_pinned"
+	// A message in the chat got unpinned.
+	MessageUnpinnedEvent string	= "message_unpinned"
+)
+
+// Creates an event in a chat that carries structured data about the event.
+func NewEvent(event string, chatId string, data any) Message {
+	return NewDataMessage(EventMessageType, event + " " + chatId, data)
+}
+
+// DeletedMessage is the data of a MessageDeletedEvent.
+type DeletedMessage struct {
+	MessageId int64		`json:"message_id"`
+	DeletedBy string	`json:"deleted_by"`
+}
+
+func (d DeletedMessage) String() string {
+	return strconv.FormatInt(d.MessageId, 10) + " " + d.DeletedBy
+}
+
+// Sends a message to every user connected to the chat.
+func (chat *Chat) broadcast(message Message) {
+	for _, users := range chat.users {
+		for user := range users {
+			user.send(message)
+		}
+	}
+}
+
+// Sends a message to every user connected to the chat except the sender, the other connections of the sender still get the message.
+func (chat *Chat) broadcastOthers(message Message, sender *User) {
+	for _, users := range chat.users {
+		for user := range users {
+			if user != sender {
+				user.send(message)
+			}
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package server
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// Every request from a client and every message to a client is sent as a frame.
+// A frame is a 4 byte big endian length followed by that many bytes of payload.
+const FrameHeaderSize int = 4
+
+// The default maximum size of the payload of a single frame.
+const DefaultMaxFrameSize uint32 = 64 * 1024
+
+// The smallest maximum frame size the server accepts, smaller frames couldn't carry most replies.
+const MinFrameSize uint32 = 4 * 1024
+
+// The maximum size of the payload of a single frame, a client that sends a bigger frame is disconnected.
+// can be changed before the server starts accepting connections, it must not be smaller than MinFrameSize.
+var MaxFrameSize uint32 = DefaultMaxFrameSize
+
+// Returned by ReadFrame when a frame is bigger than MaxFrameSize.
+// the payload of the frame is not read, so nothing else can be read from the reader.
+var ErrFrameTooLarge = errors.New("frame too large")
+
+// Reads a single frame from the reader and returns its payload.
+func ReadFrame(r *bufio.Reader) ([]byte, error) {
+	var header [FrameHeaderSize]byte
+	_, err := io.ReadFull(r, header[:])
+	if err != nil {
+		return nil, err
+	}
+
+	size := binary.BigEndian.Uint32(header[:])
+	if size > MaxFrameSize {
+		return nil, ErrFrameTooLarge
+	}
+
+	payload := make([]byte, size)
+	_, err = io.ReadFull(r, payload)
+	if err != nil {
+		return nil, err
+	}
+	return payload, nil
+}
+
+// Writes the payload to the writer as a single frame.
+func WriteFrame(w io.Writer, payload []byte) error {
+	if uint32(len(payload)) > MaxFrameSize {
+		return ErrFrameTooLarge
+	}
+
+	frame := make([]byte, FrameHeaderSize + len(payload))
+	binary.BigEndian.PutUint32(frame, uint32(len(payload)))
+	copy(frame[FrameHeaderSize:], payload)
+
+	_, err := w.Write(frame)
+	return err
+}
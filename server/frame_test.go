@@ -0,0 +1,85 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestFrameRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		payload []byte
+	}{
+		{"empty", []byte{}},
+		{"text", []byte("nm general hello")},
+		{"binary", []byte{0, 1, 2, 255}},
+		{"max size", bytes.Repeat([]byte("a"), int(MaxFrameSize))},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := WriteFrame(&buf, test.payload); err != nil {
+				t.Fatalf("WriteFrame: %v", err)
+			}
+			payload, err := ReadFrame(bufio.NewReader(&buf))
+			if err != nil {
+				t.Fatalf("ReadFrame: %v", err)
+			}
+			if !bytes.Equal(payload, test.payload) {
+				t.Errorf("got %d bytes, want %d bytes", len(payload), len(test.payload))
+			}
+		})
+	}
+}
+
+func TestWriteFrameTooLarge(t *testing.T) {
+	var buf bytes.Buffer
+	err := WriteFrame(&buf, make([]byte, MaxFrameSize + 1))
+	if !errors.Is(err, ErrFrameTooLarge) {
+		t.Fatalf("got %v, want ErrFrameTooLarge", err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("wrote %d bytes for a frame that is too large", buf.Len())
+	}
+}
+
+func TestReadFrameTooLargeIsNotRead(t *testing.T) {
+	var buf bytes.Buffer
+	var header [FrameHeaderSize]byte
+	binary.BigEndian.PutUint32(header[:], MaxFrameSize + 1)
+	buf.Write(header[:])
+	buf.Write(make([]byte, MaxFrameSize + 1))
+
+	r := bufio.NewReader(&buf)
+	_, err := ReadFrame(r)
+	if !errors.Is(err, ErrFrameTooLarge) {
+		t.Fatalf("got %v, want ErrFrameTooLarge", err)
+	}
+	if read := int(MaxFrameSize) + 1 - buf.Len() - r.Buffered(); read != 0 {
+		t.Errorf("read %d bytes of the payload of a frame that is too large", read)
+	}
+}
+
+func TestReadFrameTruncated(t *testing.T) {
+	tests := []struct {
+		name string
+		input []byte
+		want error
+	}{
+		{"no header", []byte{}, io.EOF},
+		{"partial header", []byte{0, 0}, io.ErrUnexpectedEOF},
+		{"partial payload", []byte{0, 0, 0, 5, 'a', 'b'}, io.ErrUnexpectedEOF},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := ReadFrame(bufio.NewReader(bytes.NewReader(test.input)))
+			if !errors.Is(err, test.want) {
+				t.Errorf("got %v, want %v", err, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,179 @@
+package server
+
+import (
+	"database/sql"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The maximum number of messages sent in a single reply to a GetMessagesRequestType request.
+const MaxMessagesPage int64 = 100
+
+// The modes of a GetMessagesRequestType request.
+const (
+	// Get the messages with ids from the first id to the second id.
+	MessagesRangeMode string	= "range"
+	// Get up to a limit of messages before an id, an id of 0 means before the newest message.
+	MessagesBeforeMode string	= "before"
+)
+
+// The bytes of a frame kept free for the reactions to a message,
+// so a message that fits in a frame when it is sent still fits after people react to it.
+const ReactionsReserve int = 1024
+
+// Checks whether the content of a new or edited message fits in the frames the server sends about the message.
+// the server adds the id, the author, the dates and the other fields of the message to the content and escapes it,
+// so content that fits in a request can still be too big for the reply, this is checked with the biggest values of these fields in both protocols.
+func contentFits(requestId string, chatId string, username string, content string) bool {
+	largest := StoredMessage{
+		Id: math.MaxInt64,
+		ChatId: chatId,
+		Username: username,
+		Date: sqliteDateFormat,
+		Content: content,
+		EditedAt: sqliteDateFormat,
+		ParentId: math.MaxInt64,
+	}
+	reply := Message{string: "a", requestId: requestId, content: "Edited message " + strconv.FormatInt(math.MaxInt64, 10), data: largest}
+	event := NewEvent(MessageEditedEvent, chatId, largest)
+
+	for _, mes := range []Message{reply, event} {
+		if len(encodeTextMessage(mes)) + ReactionsReserve > int(MaxFrameSize) || len(encodeJsonMessage(mes)) + ReactionsReserve > int(MaxFrameSize) {
+			return false
+		}
+	}
+	return true
+}
+
+// The columns of the messages table that are read by scanMessages, queries of messages select them first.
+const messageColumns string = "messages.id, messages.username, messages.date, messages.content, COALESCE(messages.edited_at, ''), COALESCE(messages.parentId, 0), " + reactionCountsColumn
+
+// StoredMessage is a message in a chat as it is stored in the messages table.
+type StoredMessage struct {
+	Id int64			`json:"id"`
+	ChatId string		`json:"chat_id"`
+	Username string		`json:"username"`
+	Date string			`json:"date"`
+	Content string		`json:"content"`
+	EditedAt string		`json:"edited_at,omitempty"`	// the date of the last edit, empty if the message was not edited.
+	ParentId int64		`json:"parent_id,omitempty"`	// the id of the message this message replies to, 0 if it is not a reply.
+	Reactions []ReactionCount	`json:"reactions,omitempty"`
+}
+
+// The text format is "id username date edited parent reactions content", every field before the content is always there so it can't be mistaken for the content.
+// edited is "edited" or "-", parent is the id of the message this message replies to or "-",
+// reactions are "count:emoji" pairs separated by commas or "-", and the content is escaped with textEscaper so the message takes a single line.
+func (m StoredMessage) String() string {
+	edited := "-"
+	if m.EditedAt != "" {
+		edited = "edited"
+	}
+
+	parent := "-"
+	if m.ParentId != 0 {
+		parent = strconv.FormatInt(m.ParentId, 10)
+	}
+
+	reactions := "-"
+	if len(m.Reactions) != 0 {
+		pairs := make([]string, len(m.Reactions))
+		for i, reaction := range m.Reactions {
+			pairs[i] = strconv.FormatInt(reaction.Count, 10) + ":" + reaction.Emoji
+		}
+		reactions = strings.Join(pairs, ",")
+	}
+
+	return strconv.FormatInt(m.Id, 10) + " " + m.Username + " " + m.Date + " " + edited + " " + parent + " " + reactions + " " + textEscaper.Replace(m.Content)
+}
+
+// MessageList is a list of messages in a chat ordered from the oldest to the newest.
+type MessageList []StoredMessage
+
+func (l MessageList) String() string {
+	lines := make([]string, len(l))
+	for i, message := range l {
+		lines[i] = message.String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Makes the reply with a page of messages, cut tells whether messages were left out of the page so the reply can tell the client where to continue.
+type pageReply func(page MessageList, cut bool) Message
+
+// Makes the reply with as many of the messages as fit in a single frame encoded with the protocol of the user.
+// the newest messages are left out, or the oldest ones if keepNewest is set, at least one message is always kept.
+func (u *User) fitPage(messages MessageList, keepNewest bool, reply pageReply) Message {
+	fits := func(mes Message) bool {
+		return len(u.encodeMessage(mes)) <= int(MaxFrameSize)
+	}
+
+	full := reply(messages, false)
+	if len(messages) <= 1 || fits(full) {
+		return full
+	}
+
+	page := func(count int) MessageList {
+		if keepNewest {
+			return messages[len(messages) - count:]
+		}
+		return messages[:count]
+	}
+	// the first count of messages that doesn't fit, the page has one message less.
+	count := sort.Search(len(messages) - 2, func(i int) bool {
+		return !fits(reply(page(i + 2), true))
+	}) + 1
+	return reply(page(count), true)
+}
+
+// Makes the replies to requests that continue after a message id, a page cut to fit in a frame ends with the id of its last message.
+func afterIdPage(req ClientRequest, chatId string) pageReply {
+	return func(page MessageList, cut bool) Message {
+		content := chatId + " " + strconv.Itoa(len(page))
+		if cut {
+			content += " " + strconv.FormatInt(page[len(page) - 1].Id, 10)
+		}
+		return req.ReplyData("a", content, page)
+	}
+}
+
+// Reads the messages from rows that select the messageColumns.
+func scanMessages(rows *sql.Rows, chatId string) (MessageList, error) {
+	defer rows.Close()
+
+	messages := make(MessageList, 0)
+	for rows.Next() {
+		message := StoredMessage{ChatId: chatId}
+		var reactions string
+		err := rows.Scan(&message.Id, &message.Username, &message.Date, &message.Content, &message.EditedAt, &message.ParentId, &reactions)
+		if err != nil {
+			return nil, err
+		}
+		message.Reactions = parseReactionCounts(reactions)
+		messages = append(messages, message)
+	}
+	return messages, rows.Err()
+}
+
+// The query of a thread, the message with the root id and all of the replies under it ordered by id.
+// it takes the root id, the chat id, the id after which messages are sent, 0 for the whole thread, and the limit.
+const threadQuery string = `
+	WITH RECURSIVE thread(id) AS (
+		SELECT id FROM messages WHERE id = ? and chatId = ?
+		UNION ALL
+		SELECT messages.id FROM messages JOIN thread ON messages.parentId = thread.id
+	)
+	SELECT ` + messageColumns + ` FROM messages
+	JOIN thread ON thread.id = messages.id
+	WHERE messages.id > ?
+	ORDER BY messages.id LIMIT ?
+`
+
+// Clamps the number of messages requested to the page size.
+func pageLimit(limit int64) int64 {
+	if limit <= 0 || limit > MaxMessagesPage {
+		return MaxMessagesPage
+	}
+	return limit
+}
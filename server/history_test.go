@@ -0,0 +1,78 @@
+package server
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestStoredMessageString(t *testing.T) {
+	tests := []struct {
+		name string
+		message StoredMessage
+		want string
+	}{
+		{"plain", StoredMessage{Content: "hello"}, "1 alice 2024-01-01 00:00:00 - - - hello"},
+		{"edited", StoredMessage{Content: "hello", EditedAt: "2024-01-02 00:00:00"}, "1 alice 2024-01-01 00:00:00 edited - - hello"},
+		{"reply", StoredMessage{Content: "hello", ParentId: 7}, "1 alice 2024-01-01 00:00:00 - 7 - hello"},
+		{"reactions", StoredMessage{Content: "hello", Reactions: []ReactionCount{{"👍", 2}, {"🎉", 1}}}, "1 alice 2024-01-01 00:00:00 - - 2:👍,1:🎉 hello"},
+		{"everything", StoredMessage{Content: "hello", EditedAt: "2024-01-02 00:00:00", ParentId: 7, Reactions: []ReactionCount{{"👍", 2}}}, "1 alice 2024-01-01 00:00:00 edited 7 2:👍 hello"},
+		{"content that looks like metadata", StoredMessage{Content: "(edited) (reply to 3)"}, "1 alice 2024-01-01 00:00:00 - - - (edited) (reply to 3)"},
+		{"line breaks", StoredMessage{Content: "two\nlines"}, `1 alice 2024-01-01 00:00:00 - - - two\nlines`},
+		{"carriage return", StoredMessage{Content: "crlf\r\n"}, `1 alice 2024-01-01 00:00:00 - - - crlf\r\n`},
+		{"backslash", StoredMessage{Content: `back\slash`}, `1 alice 2024-01-01 00:00:00 - - - back\\slash`},
+		{"escaped line break", StoredMessage{Content: `literal \n`}, `1 alice 2024-01-01 00:00:00 - - - literal \\n`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			message := test.message
+			message.Id, message.Username, message.Date = 1, "alice", "2024-01-01 00:00:00"
+			if got := message.String(); got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestContentFits(t *testing.T) {
+	tests := []struct {
+		name string
+		content string
+		want bool
+	}{
+		{"short", "hello", true},
+		{"fits with room for the other fields", strings.Repeat("a", int(MaxFrameSize)/2), true},
+		{"as big as a frame", strings.Repeat("a", int(MaxFrameSize) - 100), false},
+		{"too big once line breaks are escaped", strings.Repeat("\n", int(MaxFrameSize)/2), false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := contentFits("12", "room", "alice", test.content); got != test.want {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestFitPage(t *testing.T) {
+	messages := make(MessageList, 10)
+	for i := range messages {
+		messages[i] = StoredMessage{Id: int64(i + 1), Username: "alice", Date: sqliteDateFormat, Content: strings.Repeat("a", int(MaxFrameSize)/4)}
+	}
+	req := NewClientRequest(GetThreadRequestType, nil, &User{})
+	user := &User{}
+
+	mes := user.fitPage(messages[:2], false, afterIdPage(req, "room"))
+	if page := mes.data.(MessageList); len(page) != 2 || mes.content != "room 2" {
+		t.Errorf("got %d messages and content %q for a page that fits, want 2 and \"room 2\"", len(page), mes.content)
+	}
+
+	mes = user.fitPage(messages, false, afterIdPage(req, "room"))
+	if page := mes.data.(MessageList); len(page) != 3 || page[0].Id != 1 || mes.content != "room 3 3" {
+		t.Errorf("got %d messages from %d and content %q, want 3 from 1 and \"room 3 3\"", len(page), page[0].Id, mes.content)
+	}
+
+	mes = user.fitPage(messages, true, afterIdPage(req, "room"))
+	if page := mes.data.(MessageList); len(page) != 3 || page[0].Id != 8 {
+		t.Errorf("got %d messages from %d when keeping the newest, want 3 from 8", len(page), page[0].Id)
+	}
+}
@@ -0,0 +1,75 @@
+package server
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"strconv"
+)
+
+// Invite is an invite code that lets users join a chat without its password.
+type Invite struct {
+	Code string			`json:"code"`
+	ChatId string		`json:"chat_id"`
+	MaxUses int64		`json:"max_uses"`				// 0 if the invite can be used any number of times.
+	ExpiresAt string	`json:"expires_at,omitempty"`	// empty if the invite never expires.
+}
+
+func (i Invite) String() string {
+	invite := i.Code + " " + i.ChatId + " " + strconv.FormatInt(i.MaxUses, 10)
+	if i.ExpiresAt != "" {
+		invite += " " + i.ExpiresAt
+	} else {
+		invite += " -"
+	}
+	return invite
+}
+
+// The statement that adds an invite, it takes the code, the chat id, the username of the creator, the max uses and the expiry date (NULL if it never expires).
+const addInviteStatement string = "INSERT INTO invites (code, chatId, createdBy, max_uses, expires_at) VALUES (?, ?, ?, ?, ?)"
+
+// The query of the chat id of an invite that can still be used, it takes the code.
+const validInviteQuery string = `
+	SELECT chatId FROM invites
+	WHERE code = ? and (expires_at IS NULL or expires_at > datetime('now')) and (max_uses IS NULL or uses < max_uses)
+`
+
+// Generates a new random invite code.
+func newInviteCode() (string, error) {
+	code := make([]byte, 12)
+	_, err := rand.Read(code)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(code), nil
+}
+
+// Uses an invite to join the user to the chat of the invite.
+// returns false if the invite was used up or expired before it could be used.
+func redeemInvite(db *sql.DB, code string, username string, chatId string) (bool, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec("UPDATE invites SET uses = uses + 1 WHERE code = ? and (expires_at IS NULL or expires_at > datetime('now')) and (max_uses IS NULL or uses < max_uses)", code)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if affected == 0 {
+		return false, nil
+	}
+
+	_, err = tx.Exec("INSERT INTO joined (username, chatId, role) VALUES (?, ?, ?)", username, chatId, RoleMember)
+	if err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
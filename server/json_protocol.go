@@ -0,0 +1,361 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// The JSON protocol, requests and messages are JSON envelopes.
+const JsonProtocol string = "json"
+
+// The version of the JSON protocol, a client must send it in the hello and in every request.
+const JsonProtocolVersion int = 1
+
+// The type of the first request a JSON client sends to choose the JSON protocol.
+// e.g. {"v": 1, "type": "hello", "protocol": "json"}
+const HelloRequestType string = "hello"
+
+// JsonRequest is the envelope of a request in the JSON protocol.
+// The type is the same type used in the text protocol (e.g. "li", "nm", "jo").
+// Only the fields needed by the type of the request have to be set.
+type JsonRequest struct {
+	Version int				`json:"v"`
+	Type string				`json:"type"`
+	Id string				`json:"id,omitempty"`
+	Protocol string			`json:"protocol,omitempty"`
+	Username string			`json:"username,omitempty"`
+	Name string				`json:"name,omitempty"`
+	Password string			`json:"password,omitempty"`
+	NewPassword string		`json:"new_password,omitempty"`
+	Token string			`json:"token,omitempty"`
+	Role string				`json:"role,omitempty"`
+	Duration string			`json:"duration,omitempty"`
+	Reason string			`json:"reason,omitempty"`
+	ChatId string			`json:"chat_id,omitempty"`
+	ChatName string			`json:"chat_name,omitempty"`
+	ChatPassword string		`json:"chat_password,omitempty"`
+	Code string				`json:"code,omitempty"`
+	MaxUses int64			`json:"max_uses,omitempty"`
+	Visibility string		`json:"visibility,omitempty"`
+	Query string			`json:"query,omitempty"`
+	Emoji string			`json:"emoji,omitempty"`
+	Content string			`json:"content,omitempty"`
+	MessageId int64			`json:"message_id,omitempty"`
+	ParentId int64			`json:"parent_id,omitempty"`
+	FromMessageId int64		`json:"from_message_id,omitempty"`
+	ToMessageId int64		`json:"to_message_id,omitempty"`
+	BeforeMessageId int64	`json:"before_message_id,omitempty"`
+	AfterMessageId int64	`json:"after_message_id,omitempty"`
+	Limit int64				`json:"limit,omitempty"`
+}
+
+// JsonMessage is the envelope of a message in the JSON protocol.
+type JsonMessage struct {
+	Version int				`json:"v"`
+	Type string				`json:"type"`
+	Id string				`json:"id,omitempty"`
+	Code string				`json:"code,omitempty"`
+	Content string			`json:"content,omitempty"`
+	Data any				`json:"data,omitempty"`
+}
+
+// Checks whether the first frame sent by a client is a JSON hello.
+func isJsonHello(frame []byte) bool {
+	return bytes.HasPrefix(bytes.TrimSpace(frame), []byte("{"))
+}
+
+// Chooses the JSON protocol for the user if the hello is valid.
+func (u *User) jsonHandshake(frame []byte) error {
+	var hello JsonRequest
+	err := json.Unmarshal(frame, &hello)
+	if err != nil || hello.Type != HelloRequestType || hello.Protocol != JsonProtocol {
+		return CodedError{Code: ErrorCodeUnsupportedProtocol, Text: "Error: Invalid hello"}
+	}
+	if hello.Version != JsonProtocolVersion {
+		return CodedError{Code: ErrorCodeUnsupportedProtocol, Text: "Error: Unsupported protocol version " + strconv.Itoa(hello.Version)}
+	}
+
+	u.protocol = JsonProtocol
+	u.send(ClientRequest{requestId: hello.Id}.Reply("a", JsonProtocol + " " + strconv.Itoa(JsonProtocolVersion)))
+	return nil
+}
+
+// Parses a JSON request into a client request.
+// Also returns the id of the chat the request is for if it is a chat related request.
+func (u *User) parseJsonRequest(frame []byte) (ClientRequest, string, error) {
+	var req JsonRequest
+	err := json.Unmarshal(frame, &req)
+	if err != nil {
+		return ClientRequest{}, "", badRequest("Error: Invalid JSON request")
+	}
+
+	clientReq, chatId, err := u.jsonToClientRequest(req)
+	clientReq.requestId = req.Id
+	return clientReq, chatId, err
+}
+
+// Checks whether a username or a chat id sent with the JSON protocol is valid.
+// it must not be empty and must not contain whitespace, since the text protocol separates them from other fields with spaces.
+func isValidId(id string) bool {
+	return id != "" && strings.IndexFunc(id, unicode.IsSpace) == -1
+}
+
+// Maps the fields of a JSON request onto a client request.
+func (u *User) jsonToClientRequest(req JsonRequest) (ClientRequest, string, error) {
+	if req.Version != JsonProtocolVersion {
+		return ClientRequest{}, "", CodedError{Code: ErrorCodeUnsupportedProtocol, Text: "Error: Unsupported protocol version " + strconv.Itoa(req.Version)}
+	}
+
+	switch req.Type {
+	case LoginRequestType:
+		if !isValidId(req.Username) || req.Password == "" {
+			return ClientRequest{}, "", badRequest("Error: Unknown username or password")
+		}
+		return LoginRequest(req.Username, req.Password, u), "", nil
+
+	case NewUserRequestType:
+		if !isValidId(req.Username) || req.Name == "" || req.Password == "" {
+			return ClientRequest{}, "", badRequest("Error: User data format Error")
+		}
+		return NewUserRequest(req.Username, req.Name, req.Password, u), "", nil
+
+	case QuitRequestType:
+		return QuitRequest(u), "", nil
+
+	case ResumeRequestType:
+		if req.Token == "" {
+			return ClientRequest{}, "", badRequest("Error: Session token is missing")
+		}
+		return ResumeRequest(req.Token, u), "", nil
+
+	case LogoutRequestType:
+		return LogoutRequest(u), "", nil
+
+	case DeleteUserRequestType:
+		if req.Password == "" {
+			return ClientRequest{}, "", badRequest("Error: User data format Error")
+		}
+		return DeleteUserRequest(req.Password, u), "", nil
+
+	case JoinChatRequestType:
+		if !isValidId(req.ChatId) {
+			return ClientRequest{}, "", badRequest("Error: User data format Error")
+		}
+		return JoinChatRequest(req.ChatId, req.ChatPassword, u), "", nil
+
+	case LeaveChatRequestType:
+		if !isValidId(req.ChatId) {
+			return ClientRequest{}, "", badRequest("Error: User data format Error")
+		}
+		return LeaveChatRequest(req.ChatId, u), "", nil
+
+	case NewChatRequestType:
+		if !isValidId(req.ChatId) || req.ChatName == "" || req.ChatPassword == "" {
+			return ClientRequest{}, "", badRequest("Error: User data format Error")
+		}
+		return NewChatRequest(req.ChatId, req.ChatName, req.ChatPassword, u), "", nil
+
+	case DeleteChatRequestType:
+		if !isValidId(req.ChatId) || req.ChatPassword == "" {
+			return ClientRequest{}, "", badRequest("Error: User data format Error")
+		}
+		return DeleteChatRequest(req.ChatId, req.ChatPassword, u), "", nil
+
+	case GetChatsRequestType:
+		return GetChatsRequest(u), "", nil
+
+	case SetRoleRequestType:
+		if !isValidId(req.ChatId) || !isValidId(req.Username) || !IsRole(req.Role) {
+			return ClientRequest{}, "", badRequest("Error: Chat ID, username or role is missing or invalid")
+		}
+		return SetRoleRequest(req.ChatId, req.Username, req.Role, u), "", nil
+
+	case KickRequestType:
+		if !isValidId(req.ChatId) || !isValidId(req.Username) {
+			return ClientRequest{}, "", badRequest("Error: Chat ID or username is missing or invalid")
+		}
+		return KickRequest(req.ChatId, req.Username, u), "", nil
+
+	case BanRequestType:
+		if !isValidId(req.ChatId) || !isValidId(req.Username) {
+			return ClientRequest{}, "", badRequest("Error: Chat ID or username is missing or invalid")
+		}
+		duration := req.Duration
+		if duration == "" {
+			duration = PermanentBan
+		}
+		return BanRequest(req.ChatId, req.Username, duration, req.Reason, u), "", nil
+
+	case UnbanRequestType:
+		if !isValidId(req.ChatId) || !isValidId(req.Username) {
+			return ClientRequest{}, "", badRequest("Error: Chat ID or username is missing or invalid")
+		}
+		return UnbanRequest(req.ChatId, req.Username, u), "", nil
+
+	case TransferOwnershipRequestType:
+		if !isValidId(req.ChatId) || !isValidId(req.Username) {
+			return ClientRequest{}, "", badRequest("Error: Chat ID or username is missing or invalid")
+		}
+		return TransferOwnershipRequest(req.ChatId, req.Username, u), "", nil
+
+	case RenameChatRequestType:
+		if !isValidId(req.ChatId) || req.ChatName == "" {
+			return ClientRequest{}, "", badRequest("Error: Chat ID or chat name is missing or invalid")
+		}
+		return RenameChatRequest(req.ChatId, req.ChatName, u), "", nil
+
+	case ChangeChatPasswordRequestType:
+		if !isValidId(req.ChatId) || req.ChatPassword == "" {
+			return ClientRequest{}, "", badRequest("Error: Chat ID or chat password is missing or invalid")
+		}
+		return ChangeChatPasswordRequest(req.ChatId, req.ChatPassword, u), "", nil
+
+	case ChangeNameRequestType:
+		if req.Name == "" {
+			return ClientRequest{}, "", badRequest("Error: Name is missing")
+		}
+		return ChangeNameRequest(req.Name, u), "", nil
+
+	case ChangePasswordRequestType:
+		if req.Password == "" || req.NewPassword == "" {
+			return ClientRequest{}, "", badRequest("Error: Old or new password is missing")
+		}
+		return ChangePasswordRequest(req.Password, req.NewPassword, u), "", nil
+
+	case SendDirectRequestType:
+		if !isValidId(req.Username) || req.Content == "" {
+			return ClientRequest{}, "", badRequest("Error: Message is empty or username is missing or invalid")
+		}
+		return SendDirectRequest(req.Username, req.Content, u), "", nil
+
+	case CreateInviteRequestType:
+		if !isValidId(req.ChatId) {
+			return ClientRequest{}, "", badRequest("Error: Chat ID is missing or invalid")
+		}
+		duration := req.Duration
+		if duration == "" {
+			duration = PermanentBan
+		}
+		return CreateInviteRequest(req.ChatId, strconv.FormatInt(req.MaxUses, 10), duration, u), "", nil
+
+	case JoinInviteRequestType:
+		if req.Code == "" {
+			return ClientRequest{}, "", badRequest("Error: Invite code is missing")
+		}
+		return JoinInviteRequest(req.Code, u), "", nil
+
+	case RevokeInviteRequestType:
+		if req.Code == "" {
+			return ClientRequest{}, "", badRequest("Error: Invite code is missing")
+		}
+		return RevokeInviteRequest(req.Code, u), "", nil
+
+	case SetVisibilityRequestType:
+		if !isValidId(req.ChatId) || !IsVisibility(req.Visibility) {
+			return ClientRequest{}, "", badRequest("Error: Chat ID or visibility is missing or invalid")
+		}
+		return SetVisibilityRequest(req.ChatId, req.Visibility, u), "", nil
+
+	case SearchChatsRequestType:
+		return SearchChatsRequest(req.Query, u), "", nil
+
+	case NewMessageRequestType:
+		if !isValidId(req.ChatId) || req.Content == "" {
+			return ClientRequest{}, "", badRequest("Error: Message is empty or chat id is missing or invalid")
+		}
+		if req.ParentId != 0 {
+			return ReplyRequest(strconv.FormatInt(req.ParentId, 10), req.Content, u), req.ChatId, nil
+		}
+		return NewMessageRequest(req.Content, u), req.ChatId, nil
+
+	case ReplyRequestType:
+		if !isValidId(req.ChatId) || req.ParentId == 0 || req.Content == "" {
+			return ClientRequest{}, "", badRequest("Error: Message ID, content or chat id is missing or invalid")
+		}
+		return ReplyRequest(strconv.FormatInt(req.ParentId, 10), req.Content, u), req.ChatId, nil
+
+	case GetThreadRequestType:
+		if !isValidId(req.ChatId) || req.MessageId == 0 {
+			return ClientRequest{}, "", badRequest("Error: Message ID is not present or chat id is missing or invalid")
+		}
+		return GetThreadRequest(strconv.FormatInt(req.MessageId, 10), strconv.FormatInt(req.AfterMessageId, 10), u), req.ChatId, nil
+
+	case DeleteMessageRequestType:
+		if !isValidId(req.ChatId) || req.MessageId == 0 {
+			return ClientRequest{}, "", badRequest("Error: Message ID is not present or chat id is missing or invalid")
+		}
+		return DeleteMessageRequest(strconv.FormatInt(req.MessageId, 10), u), req.ChatId, nil
+
+	case EditMessageRequestType:
+		if !isValidId(req.ChatId) || req.MessageId == 0 || req.Content == "" {
+			return ClientRequest{}, "", badRequest("Error: Message ID, content or chat id is missing or invalid")
+		}
+		return EditMessageRequest(strconv.FormatInt(req.MessageId, 10), req.Content, u), req.ChatId, nil
+
+	case GetMessagesRequestType:
+		if isValidId(req.ChatId) && req.Limit != 0 {
+			return GetMessagesBeforeRequest(strconv.FormatInt(req.BeforeMessageId, 10), strconv.FormatInt(req.Limit, 10), u), req.ChatId, nil
+		}
+		if !isValidId(req.ChatId) || req.FromMessageId == 0 || req.ToMessageId == 0 {
+			return ClientRequest{}, "", badRequest("Error: Message IDs are not present empty or chat id is missing or invalid")
+		}
+		return GetMessagesRequest(strconv.FormatInt(req.FromMessageId, 10), strconv.FormatInt(req.ToMessageId, 10), u), req.ChatId, nil
+
+	case GetUsersRequestType:
+		if !isValidId(req.ChatId) {
+			return ClientRequest{}, "", badRequest("Error:Chat ID is missing or invalid")
+		}
+		return GetUsersRequest(u), req.ChatId, nil
+
+	case MarkReadRequestType:
+		if !isValidId(req.ChatId) || req.MessageId == 0 {
+			return ClientRequest{}, "", badRequest("Error: Message ID is not present or chat id is missing or invalid")
+		}
+		return MarkReadRequest(strconv.FormatInt(req.MessageId, 10), u), req.ChatId, nil
+
+	case AddReactionRequestType, RemoveReactionRequestType:
+		if !isValidId(req.ChatId) || req.MessageId == 0 || !IsValidEmoji(req.Emoji) {
+			return ClientRequest{}, "", badRequest("Error: Message ID, emoji or chat id is missing or invalid")
+		}
+		if req.Type == AddReactionRequestType {
+			return AddReactionRequest(strconv.FormatInt(req.MessageId, 10), req.Emoji, u), req.ChatId, nil
+		}
+		return RemoveReactionRequest(strconv.FormatInt(req.MessageId, 10), req.Emoji, u), req.ChatId, nil
+
+	case PinMessageRequestType, UnpinMessageRequestType:
+		if !isValidId(req.ChatId) || req.MessageId == 0 {
+			return ClientRequest{}, "", badRequest("Error: Message ID is not present or chat id is missing or invalid")
+		}
+		if req.Type == PinMessageRequestType {
+			return PinMessageRequest(strconv.FormatInt(req.MessageId, 10), u), req.ChatId, nil
+		}
+		return UnpinMessageRequest(strconv.FormatInt(req.MessageId, 10), u), req.ChatId, nil
+
+	case GetPinsRequestType:
+		if !isValidId(req.ChatId) {
+			return ClientRequest{}, "", badRequest("Error: Chat ID is missing or invalid")
+		}
+		return GetPinsRequest(strconv.FormatInt(req.AfterMessageId, 10), u), req.ChatId, nil
+	}
+
+	return ClientRequest{}, "", CodedError{Code: ErrorCodeUnknownRequest, Text: "Error: Unknown request " + req.Type}
+}
+
+// Encodes a message as a JSON envelope.
+func encodeJsonMessage(mes Message) []byte {
+	encoded, err := json.Marshal(JsonMessage{
+		Version: JsonProtocolVersion,
+		Type: mes.string,
+		Id: mes.requestId,
+		Code: mes.code,
+		Content: mes.content,
+		Data: mes.data,
+	})
+	if err != nil {
+		encoded, _ = json.Marshal(JsonMessage{Version: JsonProtocolVersion, Type: "e", Id: mes.requestId, Code: ErrorCodeInternal, Content: "Error: Could not encode message"})
+	}
+	return encoded
+}
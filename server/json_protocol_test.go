@@ -0,0 +1,193 @@
+package server
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestJsonToClientRequest(t *testing.T) {
+	tests := []struct {
+		name string
+		request JsonRequest
+		wantType string		// the expected type of the request, empty if an error is expected.
+		wantArgs []string	// the expected arguments, not checked if nil.
+		wantChatId string
+		wantCode string		// the expected error code, empty if no error is expected.
+	}{
+		{"unknown type", JsonRequest{Type: "xx"}, "", nil, "", ErrorCodeUnknownRequest},
+		{"internal connect", JsonRequest{Type: ConnectRequestType, Username: "alice"}, "", nil, "", ErrorCodeUnknownRequest},
+		{"internal disconnect", JsonRequest{Type: DisconnectRequestType, Username: "alice"}, "", nil, "", ErrorCodeUnknownRequest},
+		{"internal broadcast", JsonRequest{Type: BroadcastRequestType}, "", nil, "", ErrorCodeUnknownRequest},
+
+		{"login", JsonRequest{Type: LoginRequestType, Username: "alice", Password: "secret"}, LoginRequestType, []string{"alice", "secret"}, "", ""},
+		{"login keeps spaces in the password", JsonRequest{Type: LoginRequestType, Username: "alice", Password: " my secret "}, LoginRequestType, []string{"alice", " my secret "}, "", ""},
+		{"login without password", JsonRequest{Type: LoginRequestType, Username: "alice"}, "", nil, "", ErrorCodeBadRequest},
+		{"login without username", JsonRequest{Type: LoginRequestType, Password: "secret"}, "", nil, "", ErrorCodeBadRequest},
+		{"login with a space in the username", JsonRequest{Type: LoginRequestType, Username: "alice smith", Password: "secret"}, "", nil, "", ErrorCodeBadRequest},
+
+		{"new user", JsonRequest{Type: NewUserRequestType, Username: "alice", Name: "Alice Smith", Password: "secret"}, NewUserRequestType, []string{"alice", "Alice Smith", "secret"}, "", ""},
+		{"new user without name", JsonRequest{Type: NewUserRequestType, Username: "alice", Password: "secret"}, "", nil, "", ErrorCodeBadRequest},
+
+		{"quit", JsonRequest{Type: QuitRequestType}, QuitRequestType, nil, "", ""},
+		{"logout", JsonRequest{Type: LogoutRequestType}, LogoutRequestType, nil, "", ""},
+
+		{"resume", JsonRequest{Type: ResumeRequestType, Token: "token"}, ResumeRequestType, []string{"token"}, "", ""},
+		{"resume without token", JsonRequest{Type: ResumeRequestType}, "", nil, "", ErrorCodeBadRequest},
+
+		{"delete user", JsonRequest{Type: DeleteUserRequestType, Password: "secret"}, DeleteUserRequestType, []string{"secret"}, "", ""},
+		{"delete user without password", JsonRequest{Type: DeleteUserRequestType}, "", nil, "", ErrorCodeBadRequest},
+
+		{"join", JsonRequest{Type: JoinChatRequestType, ChatId: "room"}, JoinChatRequestType, []string{"room", ""}, "", ""},
+		{"join without chat", JsonRequest{Type: JoinChatRequestType, ChatPassword: "secret"}, "", nil, "", ErrorCodeBadRequest},
+
+		{"leave", JsonRequest{Type: LeaveChatRequestType, ChatId: "room"}, LeaveChatRequestType, []string{"room"}, "", ""},
+		{"leave without chat", JsonRequest{Type: LeaveChatRequestType}, "", nil, "", ErrorCodeBadRequest},
+
+		{"new chat", JsonRequest{Type: NewChatRequestType, ChatId: "room", ChatName: "The Room", ChatPassword: "secret"}, NewChatRequestType, []string{"room", "The Room", "secret"}, "", ""},
+		{"new chat without password", JsonRequest{Type: NewChatRequestType, ChatId: "room", ChatName: "The Room"}, "", nil, "", ErrorCodeBadRequest},
+
+		{"delete chat", JsonRequest{Type: DeleteChatRequestType, ChatId: "room", ChatPassword: "secret"}, DeleteChatRequestType, []string{"room", "secret"}, "", ""},
+		{"delete chat without password", JsonRequest{Type: DeleteChatRequestType, ChatId: "room"}, "", nil, "", ErrorCodeBadRequest},
+
+		{"get chats", JsonRequest{Type: GetChatsRequestType}, GetChatsRequestType, nil, "", ""},
+
+		{"set role", JsonRequest{Type: SetRoleRequestType, ChatId: "room", Username: "bob", Role: RoleAdmin}, SetRoleRequestType, []string{"room", "bob", RoleAdmin}, "", ""},
+		{"set invalid role", JsonRequest{Type: SetRoleRequestType, ChatId: "room", Username: "bob", Role: "king"}, "", nil, "", ErrorCodeBadRequest},
+
+		{"kick", JsonRequest{Type: KickRequestType, ChatId: "room", Username: "bob"}, KickRequestType, []string{"room", "bob"}, "", ""},
+		{"kick without username", JsonRequest{Type: KickRequestType, ChatId: "room"}, "", nil, "", ErrorCodeBadRequest},
+
+		{"ban", JsonRequest{Type: BanRequestType, ChatId: "room", Username: "bob", Duration: "24h", Reason: "spam"}, BanRequestType, []string{"room", "bob", "24h", "spam"}, "", ""},
+		{"ban without duration is permanent", JsonRequest{Type: BanRequestType, ChatId: "room", Username: "bob"}, BanRequestType, []string{"room", "bob", PermanentBan, ""}, "", ""},
+		{"ban without chat", JsonRequest{Type: BanRequestType, Username: "bob"}, "", nil, "", ErrorCodeBadRequest},
+
+		{"unban", JsonRequest{Type: UnbanRequestType, ChatId: "room", Username: "bob"}, UnbanRequestType, []string{"room", "bob"}, "", ""},
+		{"unban without username", JsonRequest{Type: UnbanRequestType, ChatId: "room"}, "", nil, "", ErrorCodeBadRequest},
+
+		{"transfer ownership", JsonRequest{Type: TransferOwnershipRequestType, ChatId: "room", Username: "bob"}, TransferOwnershipRequestType, []string{"room", "bob"}, "", ""},
+		{"transfer ownership without username", JsonRequest{Type: TransferOwnershipRequestType, ChatId: "room"}, "", nil, "", ErrorCodeBadRequest},
+
+		{"rename chat", JsonRequest{Type: RenameChatRequestType, ChatId: "room", ChatName: "New Name"}, RenameChatRequestType, []string{"room", "New Name"}, "", ""},
+		{"rename chat without name", JsonRequest{Type: RenameChatRequestType, ChatId: "room"}, "", nil, "", ErrorCodeBadRequest},
+
+		{"change chat password", JsonRequest{Type: ChangeChatPasswordRequestType, ChatId: "room", ChatPassword: "secret"}, ChangeChatPasswordRequestType, []string{"room", "secret"}, "", ""},
+		{"change chat password without password", JsonRequest{Type: ChangeChatPasswordRequestType, ChatId: "room"}, "", nil, "", ErrorCodeBadRequest},
+
+		{"change name", JsonRequest{Type: ChangeNameRequestType, Name: "Alice Smith"}, ChangeNameRequestType, []string{"Alice Smith"}, "", ""},
+		{"change name without name", JsonRequest{Type: ChangeNameRequestType}, "", nil, "", ErrorCodeBadRequest},
+
+		{"change password", JsonRequest{Type: ChangePasswordRequestType, Password: "old", NewPassword: "new"}, ChangePasswordRequestType, []string{"old", "new"}, "", ""},
+		{"change password without new password", JsonRequest{Type: ChangePasswordRequestType, Password: "old"}, "", nil, "", ErrorCodeBadRequest},
+
+		{"send direct", JsonRequest{Type: SendDirectRequestType, Username: "bob", Content: "hi"}, SendDirectRequestType, []string{"bob", "hi"}, "", ""},
+		{"send direct without content", JsonRequest{Type: SendDirectRequestType, Username: "bob"}, "", nil, "", ErrorCodeBadRequest},
+
+		{"create invite", JsonRequest{Type: CreateInviteRequestType, ChatId: "room", MaxUses: 5, Duration: "24h"}, CreateInviteRequestType, []string{"room", "5", "24h"}, "", ""},
+		{"create invite with defaults", JsonRequest{Type: CreateInviteRequestType, ChatId: "room"}, CreateInviteRequestType, []string{"room", "0", PermanentBan}, "", ""},
+		{"create invite without chat", JsonRequest{Type: CreateInviteRequestType}, "", nil, "", ErrorCodeBadRequest},
+
+		{"join invite", JsonRequest{Type: JoinInviteRequestType, Code: "code"}, JoinInviteRequestType, []string{"code"}, "", ""},
+		{"join invite without code", JsonRequest{Type: JoinInviteRequestType}, "", nil, "", ErrorCodeBadRequest},
+		{"revoke invite", JsonRequest{Type: RevokeInviteRequestType, Code: "code"}, RevokeInviteRequestType, []string{"code"}, "", ""},
+		{"revoke invite without code", JsonRequest{Type: RevokeInviteRequestType}, "", nil, "", ErrorCodeBadRequest},
+
+		{"set visibility", JsonRequest{Type: SetVisibilityRequestType, ChatId: "room", Visibility: VisibilityPublic}, SetVisibilityRequestType, []string{"room", VisibilityPublic}, "", ""},
+		{"set invalid visibility", JsonRequest{Type: SetVisibilityRequestType, ChatId: "room", Visibility: "hidden"}, "", nil, "", ErrorCodeBadRequest},
+
+		{"search chats", JsonRequest{Type: SearchChatsRequestType, Query: "go"}, SearchChatsRequestType, []string{"go"}, "", ""},
+
+		{"new message", JsonRequest{Type: NewMessageRequestType, ChatId: "room", Content: "hello\nthere"}, NewMessageRequestType, nil, "room", ""},
+		{"new message with parent is a reply", JsonRequest{Type: NewMessageRequestType, ChatId: "room", Content: "hello", ParentId: 3}, ReplyRequestType, nil, "room", ""},
+		{"new message without content", JsonRequest{Type: NewMessageRequestType, ChatId: "room"}, "", nil, "", ErrorCodeBadRequest},
+		{"new message without chat", JsonRequest{Type: NewMessageRequestType, Content: "hello"}, "", nil, "", ErrorCodeBadRequest},
+		{"new message with a line break in the chat id", JsonRequest{Type: NewMessageRequestType, ChatId: "room\nm 1", Content: "hello"}, "", nil, "", ErrorCodeBadRequest},
+
+		{"reply", JsonRequest{Type: ReplyRequestType, ChatId: "room", ParentId: 3, Content: "hello"}, ReplyRequestType, nil, "room", ""},
+		{"reply without parent", JsonRequest{Type: ReplyRequestType, ChatId: "room", Content: "hello"}, "", nil, "", ErrorCodeBadRequest},
+
+		{"get thread", JsonRequest{Type: GetThreadRequestType, ChatId: "room", MessageId: 3}, GetThreadRequestType, []string{"3", "0"}, "room", ""},
+		{"get thread after a message", JsonRequest{Type: GetThreadRequestType, ChatId: "room", MessageId: 3, AfterMessageId: 7}, GetThreadRequestType, []string{"3", "7"}, "room", ""},
+		{"get thread without message", JsonRequest{Type: GetThreadRequestType, ChatId: "room"}, "", nil, "", ErrorCodeBadRequest},
+
+		{"delete message", JsonRequest{Type: DeleteMessageRequestType, ChatId: "room", MessageId: 3}, DeleteMessageRequestType, nil, "room", ""},
+		{"delete message without message", JsonRequest{Type: DeleteMessageRequestType, ChatId: "room"}, "", nil, "", ErrorCodeBadRequest},
+
+		{"edit message", JsonRequest{Type: EditMessageRequestType, ChatId: "room", MessageId: 3, Content: "new"}, EditMessageRequestType, nil, "room", ""},
+		{"edit message without content", JsonRequest{Type: EditMessageRequestType, ChatId: "room", MessageId: 3}, "", nil, "", ErrorCodeBadRequest},
+
+		{"get messages range", JsonRequest{Type: GetMessagesRequestType, ChatId: "room", FromMessageId: 1, ToMessageId: 10}, GetMessagesRequestType, nil, "room", ""},
+		{"get messages before", JsonRequest{Type: GetMessagesRequestType, ChatId: "room", Limit: 20}, GetMessagesRequestType, nil, "room", ""},
+		{"get messages without range", JsonRequest{Type: GetMessagesRequestType, ChatId: "room", FromMessageId: 1}, "", nil, "", ErrorCodeBadRequest},
+
+		{"get users", JsonRequest{Type: GetUsersRequestType, ChatId: "room"}, GetUsersRequestType, nil, "room", ""},
+		{"get users without chat", JsonRequest{Type: GetUsersRequestType}, "", nil, "", ErrorCodeBadRequest},
+
+		{"mark read", JsonRequest{Type: MarkReadRequestType, ChatId: "room", MessageId: 3}, MarkReadRequestType, nil, "room", ""},
+		{"mark read without message", JsonRequest{Type: MarkReadRequestType, ChatId: "room"}, "", nil, "", ErrorCodeBadRequest},
+
+		{"add reaction", JsonRequest{Type: AddReactionRequestType, ChatId: "room", MessageId: 3, Emoji: "👍"}, AddReactionRequestType, nil, "room", ""},
+		{"add reaction with invalid emoji", JsonRequest{Type: AddReactionRequestType, ChatId: "room", MessageId: 3, Emoji: "a b"}, "", nil, "", ErrorCodeBadRequest},
+		{"add reaction with too long emoji", JsonRequest{Type: AddReactionRequestType, ChatId: "room", MessageId: 3, Emoji: strings.Repeat("a", MaxEmojiSize + 1)}, "", nil, "", ErrorCodeBadRequest},
+		{"remove reaction", JsonRequest{Type: RemoveReactionRequestType, ChatId: "room", MessageId: 3, Emoji: "👍"}, RemoveReactionRequestType, nil, "room", ""},
+		{"remove reaction without emoji", JsonRequest{Type: RemoveReactionRequestType, ChatId: "room", MessageId: 3}, "", nil, "", ErrorCodeBadRequest},
+
+		{"pin", JsonRequest{Type: PinMessageRequestType, ChatId: "room", MessageId: 3}, PinMessageRequestType, nil, "room", ""},
+		{"pin without message", JsonRequest{Type: PinMessageRequestType, ChatId: "room"}, "", nil, "", ErrorCodeBadRequest},
+		{"unpin", JsonRequest{Type: UnpinMessageRequestType, ChatId: "room", MessageId: 3}, UnpinMessageRequestType, nil, "room", ""},
+
+		{"get pins", JsonRequest{Type: GetPinsRequestType, ChatId: "room"}, GetPinsRequestType, []string{"0"}, "room", ""},
+		{"get pins after a message", JsonRequest{Type: GetPinsRequestType, ChatId: "room", AfterMessageId: 7}, GetPinsRequestType, []string{"7"}, "room", ""},
+		{"get pins without chat", JsonRequest{Type: GetPinsRequestType}, "", nil, "", ErrorCodeBadRequest},
+	}
+	user := &User{}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request := test.request
+			request.Version = JsonProtocolVersion
+			req, chatId, err := user.jsonToClientRequest(request)
+			if code := errorCode(err); code != test.wantCode {
+				t.Fatalf("got error %v, want code %q", err, test.wantCode)
+			}
+			if test.wantCode != "" {
+				return
+			}
+			if req.string != test.wantType {
+				t.Errorf("got type %q, want %q", req.string, test.wantType)
+			}
+			if chatId != test.wantChatId {
+				t.Errorf("got chat id %q, want %q", chatId, test.wantChatId)
+			}
+			if test.wantArgs != nil && !reflect.DeepEqual(req.args, test.wantArgs) {
+				t.Errorf("got args %q, want %q", req.args, test.wantArgs)
+			}
+		})
+	}
+}
+
+func TestJsonToClientRequestVersion(t *testing.T) {
+	user := &User{}
+	for _, version := range []int{0, JsonProtocolVersion + 1} {
+		_, _, err := user.jsonToClientRequest(JsonRequest{Version: version, Type: LoginRequestType, Username: "alice", Password: "secret"})
+		if code := errorCode(err); code != ErrorCodeUnsupportedProtocol {
+			t.Errorf("got %v for version %d, want code %q", err, version, ErrorCodeUnsupportedProtocol)
+		}
+	}
+}
+
+func TestParseJsonRequest(t *testing.T) {
+	user := &User{}
+
+	req, chatId, err := user.parseJsonRequest([]byte(`{"v": 1, "type": "nm", "id": "7", "chat_id": "room", "content": "hi"}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if req.requestId != "7" || req.string != NewMessageRequestType || chatId != "room" {
+		t.Errorf("got request id %q, type %q and chat %q", req.requestId, req.string, chatId)
+	}
+
+	_, _, err = user.parseJsonRequest([]byte(`{"v": 1, "type": `))
+	if code := errorCode(err); code != ErrorCodeBadRequest {
+		t.Errorf("got %v for invalid JSON, want code %q", err, ErrorCodeBadRequest)
+	}
+}
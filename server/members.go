@@ -0,0 +1,52 @@
+package server
+
+import (
+	"database/sql"
+	"strings"
+)
+
+// Member is a user who joined a chat.
+type Member struct {
+	Username string		`json:"username"`
+	Name string			`json:"name"`
+	JoinedAt string		`json:"joined_at"`
+	Role string			`json:"role"`
+	Online bool			`json:"online"`	// whether the user is connected to the chat right now.
+}
+
+func (m Member) String() string {
+	presence := "offline"
+	if m.Online {
+		presence = "online"
+	}
+	return m.Username + " " + m.Role + " " + presence + " " + m.JoinedAt + " " + textEscaper.Replace(m.Name)
+}
+
+// MemberList is a list of the members of a chat ordered by when they joined.
+type MemberList []Member
+
+func (l MemberList) String() string {
+	lines := make([]string, len(l))
+	for i, member := range l {
+		lines[i] = member.String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Reads the members of the chat from rows that select the username, name, join date and role of members.
+// it reads the connected users of the chat so it is only called by the goroutine of the chat.
+func (chat *Chat) scanMembers(rows *sql.Rows) (MemberList, error) {
+	defer rows.Close()
+
+	members := make(MemberList, 0)
+	for rows.Next() {
+		var member Member
+		err := rows.Scan(&member.Username, &member.Name, &member.JoinedAt, &member.Role)
+		if err != nil {
+			return nil, err
+		}
+		_, member.Online = chat.users[member.Username]
+		members = append(members, member)
+	}
+	return members, rows.Err()
+}
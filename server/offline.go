@@ -0,0 +1,57 @@
+package server
+
+import (
+	"database/sql"
+	"log"
+	"strconv"
+)
+
+// The maximum number of missed messages sent for each chat when a user logs in.
+// if more messages were missed, only the newest ones are sent and the client can get the rest with GetMessagesRequestType.
+const MaxMissedMessages int64 = 50
+
+// The query of the newest messages by other users after the read marker of a user in a chat.
+// it takes the chat id, the username, the chat id, the username and the limit.
+const missedMessagesQuery string = `
+	SELECT * FROM (
+		SELECT ` + messageColumns + ` FROM messages
+		WHERE chatId = ?
+			and id > COALESCE((SELECT lastReadId FROM read_markers WHERE username = ? and chatId = ?), 0)
+			and username != ?
+		ORDER BY id DESC LIMIT ?
+	) ORDER BY id
+`
+
+// Sends the messages the sender of the request missed while logged out, it is sent after logging in.
+// a message is sent for each chat with missed messages, its content is "missed chatId count" where count is the number of all missed messages,
+// if the messages don't fit in a frame only the newest ones are sent and the content ends with the id of the oldest message sent.
+// counts are the unread counts of the user and getMissedMessages is the statement of the missedMessagesQuery.
+func (cm *ServerManager) sendMissedMessages(req ClientRequest, counts UnreadList, getMissedMessages *sql.Stmt) {
+	username := req.sender.username
+	for _, count := range counts {
+		if count.Unread == 0 {
+			continue
+		}
+
+		cm.mu.RLock()
+		rows, err := getMissedMessages.Query(count.ChatId, username, count.ChatId, username, MaxMissedMessages)
+		cm.mu.RUnlock()
+		if err != nil {
+			log.Println("Error: Could not query missed messages:", err)
+			continue
+		}
+
+		messages, err := scanMessages(rows, count.ChatId)
+		if err != nil {
+			log.Println("Error: Could not read missed messages:", err)
+			continue
+		}
+		req.sender.send(req.sender.fitPage(messages, true, func(page MessageList, cut bool) Message {
+			content := "missed " + count.ChatId + " " + strconv.FormatInt(count.Unread, 10)
+			if cut {
+				content += " " + strconv.FormatInt(page[0].Id, 10)
+			}
+			return req.ReplyData("n", content, page)
+		}))
+	}
+}
@@ -0,0 +1,39 @@
+package server
+
+import "database/sql"
+
+// OwnerChange is the data of an OwnerChangedEvent.
+type OwnerChange struct {
+	Owner string			`json:"owner"`
+	PreviousOwner string	`json:"previous_owner"`
+}
+
+func (o OwnerChange) String() string {
+	return o.Owner + " " + o.PreviousOwner
+}
+
+// Makes a member of the chat the owner of the chat in the database, the previous owner becomes an admin.
+func transferOwnership(db *sql.DB, chatId string, owner string, newOwner string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("UPDATE chats SET owner = ? WHERE chatId = ?", newOwner, chatId)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("UPDATE joined SET role = ? WHERE username = ? and chatId = ?", RoleOwner, newOwner, chatId)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("UPDATE joined SET role = ? WHERE username = ? and chatId = ?", RoleAdmin, owner, chatId)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
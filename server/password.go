@@ -0,0 +1,129 @@
+package server
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"log"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Checks whether a stored password is a bcrypt hash, passwords that aren't are plaintext passwords from before hashing was added.
+// a plaintext password that only starts like a hash, e.g. "$2secret", is still plaintext since it can't be parsed as a hash.
+func isPasswordHash(stored string) bool {
+	_, err := bcrypt.Cost([]byte(stored))
+	return err == nil
+}
+
+// Hashes a password of a user or a chat with a salted bcrypt hash.
+// bcrypt is slow on purpose, the server manager hashes and checks passwords on other goroutines with hashPassword and checkPassword.
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// Checks whether the password matches the stored hash.
+// plaintext passwords that haven't been migrated yet are compared in constant time too.
+func CheckPassword(stored string, password string) bool {
+	if !isPasswordHash(stored) {
+		return subtle.ConstantTimeCompare([]byte(stored), []byte(password)) == 1
+	}
+	return bcrypt.CompareHashAndPassword([]byte(stored), []byte(password)) == nil
+}
+
+// The result of checking a password against a stored hash, a request is sent back to the server manager with it.
+type passwordCheck struct {
+	hash string
+	ok bool
+}
+
+// The result of hashing a password, a request is sent back to the server manager with it.
+type passwordHash struct {
+	password string
+	hash string
+	err error
+}
+
+// Checks the password sent with a request against the stored hash without blocking the server manager.
+// the first time it is called for a request it returns done as false and checks the password on another goroutine,
+// which sends the request back to the server manager with the result, so the handler of the request runs again and gets the result.
+// the handler must not change anything before the check, and the password is checked again if the stored hash changed in the meantime.
+func (cm *ServerManager) checkPassword(req ClientRequest, hash string, password string) (ok bool, done bool) {
+	if req.check != nil && req.check.hash == hash {
+		return req.check.ok, true
+	}
+
+	go func() {
+		req.check = &passwordCheck{hash: hash, ok: CheckPassword(hash, password)}
+		cm.ManagerChan <- req
+	}()
+	return false, false
+}
+
+// Hashes a password sent with a request without blocking the server manager, it works like checkPassword.
+func (cm *ServerManager) hashPassword(req ClientRequest, password string) (hash string, done bool, err error) {
+	if req.hashed != nil && req.hashed.password == password {
+		return req.hashed.hash, true, req.hashed.err
+	}
+
+	go func() {
+		hash, err := HashPassword(password)
+		req.hashed = &passwordHash{password: password, hash: hash, err: err}
+		cm.ManagerChan <- req
+	}()
+	return "", false, nil
+}
+
+// Hashes the plaintext passwords of users and chats that were stored before hashing was added.
+// It is safe to call on every startup, passwords that are already hashed are skipped.
+func MigratePlaintextPasswords() {
+	db, err := sql.Open("sqlite3", DatabasePath)
+	if err != nil {
+		log.Fatalln("ERROR: COULD NOT OPEN DATABASE:", err)
+	}
+	defer db.Close()
+
+	migratePasswords(db, "users", "username")
+	migratePasswords(db, "chats", "chatId")
+}
+
+// Hashes the plaintext passwords in the password column of a table.
+// the key is a unique column of the table that is used to update each row.
+func migratePasswords(db *sql.DB, table string, key string) {
+	rows, err := db.Query("SELECT " + key + ", password FROM " + table)
+	if err != nil {
+		log.Fatalln("ERROR: COULD NOT QUERY PASSWORDS:", err)
+	}
+
+	plaintext := make(map[string]string)
+	for rows.Next() {
+		var id, password string
+		err := rows.Scan(&id, &password)
+		if err != nil {
+			log.Fatalln("ERROR: COULD NOT READ ROW:", err)
+		}
+		if !isPasswordHash(password) {
+			plaintext[id] = password
+		}
+	}
+	rows.Close()
+
+	for id, password := range plaintext {
+		hash, err := HashPassword(password)
+		if err != nil {
+			log.Fatalln("ERROR: COULD NOT HASH PASSWORD:", err)
+		}
+
+		_, err = db.Exec("UPDATE " + table + " SET password = ? WHERE " + key + " = ?", hash, id)
+		if err != nil {
+			log.Fatalln("ERROR: COULD NOT UPDATE PASSWORD:", err)
+		}
+	}
+
+	if len(plaintext) != 0 {
+		log.Println("Hashed", len(plaintext), "plaintext passwords in", table)
+	}
+}
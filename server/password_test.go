@@ -0,0 +1,65 @@
+package server
+
+import "testing"
+
+func TestCheckPassword(t *testing.T) {
+	hash, err := HashPassword("secret")
+	if err != nil {
+		t.Fatalf("HashPassword: %v", err)
+	}
+	dollarHash, err := HashPassword("$2secret")
+	if err != nil {
+		t.Fatalf("HashPassword: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		stored string
+		password string
+		want bool
+	}{
+		{"hash matches", hash, "secret", true},
+		{"hash doesn't match", hash, "wrong", false},
+		{"hash isn't compared as plaintext", hash, hash, false},
+		{"hash of a password starting like a hash", dollarHash, "$2secret", true},
+		{"plaintext matches", "secret", "secret", true},
+		{"plaintext doesn't match", "secret", "wrong", false},
+		{"plaintext starting like a hash matches", "$2secret", "$2secret", true},
+		{"plaintext starting like a hash doesn't match", "$2secret", "secret", false},
+		{"plaintext of a different length", "secret", "secrets", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := CheckPassword(test.stored, test.password)
+			if got != test.want {
+				t.Errorf("CheckPassword(%q, %q) = %v, want %v", test.stored, test.password, got, test.want)
+			}
+		})
+	}
+}
+
+func TestCheckPasswordOffManager(t *testing.T) {
+	hash, err := HashPassword("secret")
+	if err != nil {
+		t.Fatalf("HashPassword: %v", err)
+	}
+	cm := &ServerManager{ManagerChan: make(chan ClientRequest, 1)}
+	req := LoginRequest("alice", "secret", &User{})
+
+	if _, done := cm.checkPassword(req, hash, "secret"); done {
+		t.Fatalf("the password was checked on the server manager goroutine")
+	}
+	req = <-cm.ManagerChan
+	if ok, done := cm.checkPassword(req, hash, "secret"); !done || !ok {
+		t.Errorf("got ok %v and done %v for the request sent back, want true and true", ok, done)
+	}
+
+	other, err := HashPassword("other")
+	if err != nil {
+		t.Fatalf("HashPassword: %v", err)
+	}
+	if _, done := cm.checkPassword(req, other, "secret"); done {
+		t.Errorf("the result of the check was used for another hash")
+	}
+	<-cm.ManagerChan
+}
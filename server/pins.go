@@ -0,0 +1,29 @@
+package server
+
+import "strconv"
+
+// The maximum number of pinned messages in a chat.
+const MaxPinsPerChat int64 = 50
+
+// The statement that pins a message, it takes the chat id, the message id and the username of the pinner.
+// it does nothing if the message is already pinned.
+const pinStatement string = "INSERT INTO pins (chatId, messageId, pinnedBy) VALUES (?, ?, ?) ON CONFLICT DO NOTHING"
+
+// The query of the pinned messages of a chat ordered by when they were pinned,
+// it takes the chat id, the chat id again and the id of the pinned message after which messages are sent, 0 for all of them.
+const pinnedMessagesQuery string = `
+	SELECT ` + messageColumns + ` FROM pins JOIN messages ON messages.id = pins.messageId
+	WHERE pins.chatId = ?
+		and pins.id > COALESCE((SELECT id FROM pins WHERE chatId = ? and messageId = ?), 0)
+	ORDER BY pins.id
+`
+
+// Pin is the data of a MessagePinnedEvent or a MessageUnpinnedEvent.
+type Pin struct {
+	MessageId int64	`json:"message_id"`
+	By string		`json:"by"`
+}
+
+func (p Pin) String() string {
+	return strconv.FormatInt(p.MessageId, 10) + " " + p.By
+}
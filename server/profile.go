@@ -0,0 +1,34 @@
+package server
+
+import "database/sql"
+
+// NameChange is the data of a NameChangedEvent.
+type NameChange struct {
+	Username string	`json:"username"`
+	Name string		`json:"name"`
+}
+
+func (n NameChange) String() string {
+	return n.Username + " " + textEscaper.Replace(n.Name)
+}
+
+// Changes the password of the user in the database and deletes all of their sessions except the session with the token hash.
+func changePassword(db *sql.DB, username string, hash string, tokenHash string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("UPDATE users SET password = ? WHERE username = ?", hash, username)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM sessions WHERE username = ? and tokenHash != ?", username, tokenHash)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,63 @@
+package server
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// The maximum size in bytes of the emoji of a reaction.
+const MaxEmojiSize int = 32
+
+// The column of the reaction counts of a message, it is "emoji count" pairs separated by spaces ordered by the first reaction with each emoji.
+const reactionCountsColumn string = `
+	COALESCE((
+		SELECT group_concat(emoji || ' ' || count, ' ') FROM (
+			SELECT emoji, COUNT(*) AS count FROM reactions
+			WHERE reactions.messageId = messages.id
+			GROUP BY emoji ORDER BY MIN(reactions.id)
+		)
+	), '')
+`
+
+// The statement that adds a reaction, it takes the message id, the username and the emoji.
+// it does nothing if the user already reacted to the message with the emoji.
+const addReactionStatement string = "INSERT INTO reactions (messageId, username, emoji) VALUES (?, ?, ?) ON CONFLICT DO NOTHING"
+
+// ReactionCount is the number of users who reacted to a message with an emoji.
+type ReactionCount struct {
+	Emoji string	`json:"emoji"`
+	Count int64		`json:"count"`
+}
+
+// Parses the reaction counts from the reactionCountsColumn.
+func parseReactionCounts(column string) []ReactionCount {
+	fields := strings.Fields(column)
+
+	counts := make([]ReactionCount, 0, len(fields)/2)
+	for i := 0; i+1 < len(fields); i += 2 {
+		count, err := strconv.ParseInt(fields[i+1], 10, 64)
+		if err != nil {
+			continue
+		}
+		counts = append(counts, ReactionCount{Emoji: fields[i], Count: count})
+	}
+	return counts
+}
+
+// Checks whether the emoji can be used in a reaction, it must not be empty, must not be bigger than MaxEmojiSize and must not contain spaces or commas.
+// commas separate the reactions of a message in the text protocol.
+func IsValidEmoji(emoji string) bool {
+	return emoji != "" && len(emoji) <= MaxEmojiSize && strings.IndexFunc(emoji, unicode.IsSpace) == -1 && !strings.Contains(emoji, ",")
+}
+
+// Reaction is the data of a ReactionAddedEvent or a ReactionRemovedEvent.
+type Reaction struct {
+	MessageId int64		`json:"message_id"`
+	Username string		`json:"username"`
+	Emoji string		`json:"emoji"`
+}
+
+func (r Reaction) String() string {
+	return strconv.FormatInt(r.MessageId, 10) + " " + r.Username + " " + r.Emoji
+}
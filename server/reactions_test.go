@@ -0,0 +1,49 @@
+package server
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseReactionCounts(t *testing.T) {
+	tests := []struct {
+		column string
+		want []ReactionCount
+	}{
+		{"", []ReactionCount{}},
+		{"👍 2", []ReactionCount{{"👍", 2}}},
+		{"👍 2 🎉 1", []ReactionCount{{"👍", 2}, {"🎉", 1}}},
+		{"👍 x 🎉 1", []ReactionCount{{"🎉", 1}}},
+		{"👍 2 🎉", []ReactionCount{{"👍", 2}}},
+	}
+	for _, test := range tests {
+		got := parseReactionCounts(test.column)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("parseReactionCounts(%q) = %v, want %v", test.column, got, test.want)
+		}
+	}
+}
+
+func TestIsValidEmoji(t *testing.T) {
+	tests := []struct {
+		emoji string
+		want bool
+	}{
+		{"👍", true},
+		{":+1:", true},
+		{"a", true},
+		{strings.Repeat("a", MaxEmojiSize), true},
+		{"", false},
+		{strings.Repeat("a", MaxEmojiSize + 1), false},
+		{"👍 👍", false},
+		{"👍\n", false},
+		{"\t", false},
+		{"👍,🎉", false},
+	}
+	for _, test := range tests {
+		if got := IsValidEmoji(test.emoji); got != test.want {
+			t.Errorf("IsValidEmoji(%q) = %v, want %v", test.emoji, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package server
+
+import (
+	"database/sql"
+	"strconv"
+	"strings"
+)
+
+// ReadReceipt is the data of a MessageReadEvent.
+type ReadReceipt struct {
+	Username string		`json:"username"`
+	MessageId int64		`json:"message_id"`	// the id of the last message the user has read.
+}
+
+func (r ReadReceipt) String() string {
+	return r.Username + " " + strconv.FormatInt(r.MessageId, 10)
+}
+
+// UnreadCount is the number of messages by other users after the read marker of a user in a chat.
+type UnreadCount struct {
+	ChatId string	`json:"chat_id"`
+	Unread int64	`json:"unread"`
+}
+
+func (u UnreadCount) String() string {
+	return u.ChatId + " " + strconv.FormatInt(u.Unread, 10)
+}
+
+// UnreadList is the unread counts of every chat a user has joined.
+type UnreadList []UnreadCount
+
+func (l UnreadList) String() string {
+	lines := make([]string, len(l))
+	for i, unread := range l {
+		lines[i] = unread.String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// The query of the unread counts of the chats a user has joined, it takes the username.
+const unreadCountsQuery string = `
+	SELECT joined.chatId,
+		(SELECT COUNT(*) FROM messages WHERE messages.chatId = joined.chatId and messages.id > COALESCE(read_markers.lastReadId, 0) and messages.username != joined.username)
+	FROM joined
+	LEFT JOIN read_markers ON read_markers.username = joined.username and read_markers.chatId = joined.chatId
+	WHERE joined.username = ?
+	ORDER BY joined.id
+`
+
+// The statement that moves the read marker of a user in a chat forward, it takes the username, the chat id and the message id.
+// the read marker never moves back to an older message, in that case no rows are affected.
+const markReadStatement string = `
+	INSERT INTO read_markers (username, chatId, lastReadId) VALUES (?, ?, ?)
+	ON CONFLICT (username, chatId) DO UPDATE SET
+		lastReadId = excluded.lastReadId,
+		updated_at = datetime('now')
+	WHERE excluded.lastReadId > read_markers.lastReadId
+`
+
+// Reads the unread counts from rows of the unreadCountsQuery.
+func scanUnreadCounts(rows *sql.Rows) (UnreadList, error) {
+	defer rows.Close()
+
+	counts := make(UnreadList, 0)
+	for rows.Next() {
+		var count UnreadCount
+		err := rows.Scan(&count.ChatId, &count.Unread)
+		if err != nil {
+			return nil, err
+		}
+		counts = append(counts, count)
+	}
+	return counts, rows.Err()
+}
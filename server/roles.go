@@ -0,0 +1,99 @@
+package server
+
+import (
+	"database/sql"
+	"strings"
+)
+
+// The roles of the members of a chat, from the most to the least powerful.
+const (
+	// The owner of the chat, there is exactly one owner for each chat.
+	RoleOwner string		= "owner"
+	// Can do everything the owner can except deleting the chat and changing the owner.
+	RoleAdmin string		= "admin"
+	// Can moderate the messages and members of the chat.
+	RoleModerator string	= "moderator"
+	// Can send and read messages.
+	RoleMember string		= "member"
+)
+
+// The rank of each role, a higher rank is more powerful.
+var roleRanks = map[string]int{
+	RoleOwner: 3,
+	RoleAdmin: 2,
+	RoleModerator: 1,
+	RoleMember: 0,
+}
+
+// The actions in a chat that need a role.
+const (
+	DeleteMessagePermission string	= "delete_message"
+	KickPermission string			= "kick"
+	BanPermission string			= "ban"
+	RenameChatPermission string		= "rename_chat"
+	ChangeChatPasswordPermission string	= "change_password"
+	InvitePermission string			= "invite"
+	SetVisibilityPermission string	= "set_visibility"
+	PinPermission string			= "pin"
+	SetRolePermission string		= "set_role"
+	DeleteChatPermission string		= "delete_chat"
+)
+
+// The least powerful role that can do each action.
+var permissions = map[string]string{
+	DeleteMessagePermission: RoleModerator,
+	KickPermission: RoleModerator,
+	BanPermission: RoleAdmin,
+	RenameChatPermission: RoleAdmin,
+	ChangeChatPasswordPermission: RoleAdmin,
+	InvitePermission: RoleAdmin,
+	SetVisibilityPermission: RoleAdmin,
+	PinPermission: RoleAdmin,
+	SetRolePermission: RoleAdmin,
+	DeleteChatPermission: RoleOwner,
+}
+
+// Checks whether the string is one of the roles.
+func IsRole(role string) bool {
+	_, ok := roleRanks[strings.ToLower(role)]
+	return ok
+}
+
+// Checks whether a member with the role can do the action.
+// users who haven't joined the chat have an empty role and can't do any action.
+func CanPerform(role string, action string) bool {
+	required, ok := permissions[action]
+	if !ok {
+		return false
+	}
+	rank, ok := roleRanks[role]
+	if !ok {
+		return false
+	}
+	return rank >= roleRanks[required]
+}
+
+// Checks whether a member with the role can act on a member with the target role, e.g. kicking them or changing their role.
+// members can only act on members with less powerful roles.
+func Outranks(role string, target string) bool {
+	return roleRanks[role] > roleRanks[target]
+}
+
+// Gets the role of a user in a chat with the getRole statement that takes the username and the chat id.
+// returns sql.ErrNoRows if the user hasn't joined the chat.
+func getMemberRole(getRole *sql.Stmt, username string, chatId string) (string, error) {
+	var role string
+	err := getRole.QueryRow(username, chatId).Scan(&role)
+	return role, err
+}
+
+// RoleChange is the data of a RoleChangedEvent.
+type RoleChange struct {
+	Username string		`json:"username"`
+	Role string			`json:"role"`
+	ChangedBy string	`json:"changed_by"`
+}
+
+func (r RoleChange) String() string {
+	return r.Username + " " + r.Role + " " + r.ChangedBy
+}
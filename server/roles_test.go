@@ -0,0 +1,70 @@
+package server
+
+import "testing"
+
+func TestCanPerform(t *testing.T) {
+	tests := []struct {
+		role string
+		action string
+		want bool
+	}{
+		{RoleMember, DeleteMessagePermission, false},
+		{RoleModerator, DeleteMessagePermission, true},
+		{RoleModerator, KickPermission, true},
+		{RoleModerator, BanPermission, false},
+		{RoleAdmin, BanPermission, true},
+		{RoleAdmin, RenameChatPermission, true},
+		{RoleAdmin, ChangeChatPasswordPermission, true},
+		{RoleAdmin, InvitePermission, true},
+		{RoleAdmin, SetVisibilityPermission, true},
+		{RoleAdmin, PinPermission, true},
+		{RoleAdmin, SetRolePermission, true},
+		{RoleAdmin, DeleteChatPermission, false},
+		{RoleOwner, DeleteChatPermission, true},
+		{RoleOwner, KickPermission, true},
+		{RoleOwner, "unknown_action", false},
+		{"", KickPermission, false},
+		{"", DeleteMessagePermission, false},
+		{"superuser", KickPermission, false},
+	}
+	for _, test := range tests {
+		if got := CanPerform(test.role, test.action); got != test.want {
+			t.Errorf("CanPerform(%q, %q) = %v, want %v", test.role, test.action, got, test.want)
+		}
+	}
+}
+
+func TestOutranks(t *testing.T) {
+	tests := []struct {
+		role string
+		target string
+		want bool
+	}{
+		{RoleOwner, RoleAdmin, true},
+		{RoleAdmin, RoleModerator, true},
+		{RoleModerator, RoleMember, true},
+		{RoleOwner, RoleMember, true},
+		{RoleAdmin, RoleAdmin, false},
+		{RoleMember, RoleMember, false},
+		{RoleAdmin, RoleOwner, false},
+		{RoleMember, RoleModerator, false},
+	}
+	for _, test := range tests {
+		if got := Outranks(test.role, test.target); got != test.want {
+			t.Errorf("Outranks(%q, %q) = %v, want %v", test.role, test.target, got, test.want)
+		}
+	}
+}
+
+func TestIsRole(t *testing.T) {
+	for _, role := range []string{RoleOwner, RoleAdmin, RoleModerator, RoleMember, "Admin"} {
+		if !IsRole(role) {
+			t.Errorf("IsRole(%q) = false, want true", role)
+		}
+	}
+	for _, role := range []string{"", "superuser"} {
+		if IsRole(role) {
+			t.Errorf("IsRole(%q) = true, want false", role)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package server
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The visibilities of chats.
+const (
+	// The chat is found by searching for chats and can be joined without its password.
+	VisibilityPublic string		= "public"
+	// The chat can only be joined with its password or an invite.
+	VisibilityPrivate string	= "private"
+)
+
+// The maximum number of chats sent in a single reply to a SearchChatsRequestType request.
+const MaxSearchResults int = 50
+
+// ChatSearchResult is a public chat found by searching for chats.
+type ChatSearchResult struct {
+	ChatId string		`json:"chat_id"`
+	ChatName string		`json:"chat_name"`
+	MemberCount int64	`json:"member_count"`
+}
+
+func (r ChatSearchResult) String() string {
+	return r.ChatId + " " + strconv.FormatInt(r.MemberCount, 10) + " " + textEscaper.Replace(r.ChatName)
+}
+
+// ChatSearchResults is the list of chats found by searching for chats ordered by their ids.
+type ChatSearchResults []ChatSearchResult
+
+func (l ChatSearchResults) String() string {
+	lines := make([]string, len(l))
+	for i, chat := range l {
+		lines[i] = chat.String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Checks whether the visibility is one of the visibilities.
+func IsVisibility(visibility string) bool {
+	return visibility == VisibilityPublic || visibility == VisibilityPrivate
+}
+
+// Finds up to MaxSearchResults public chats with an id or a name that contains the query, ignoring case.
+// an empty query matches every public chat.
+func (cm *ServerManager) searchChats(query string) []*Chat {
+	query = strings.ToLower(query)
+
+	chats := make([]*Chat, 0)
+	for chatId, chat := range cm.chats {
+		if !chat.public {
+			continue
+		}
+		if strings.Contains(strings.ToLower(chatId), query) || strings.Contains(strings.ToLower(chat.chatName), query) {
+			chats = append(chats, chat)
+		}
+	}
+
+	sort.Slice(chats, func(i, j int) bool {
+		return chats[i].chatId < chats[j].chatId
+	})
+	if len(chats) > MaxSearchResults {
+		chats = chats[:MaxSearchResults]
+	}
+	return chats
+}
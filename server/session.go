@@ -0,0 +1,59 @@
+package server
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"time"
+)
+
+// How long a session is valid for after it is created.
+const SessionDuration time.Duration = 30 * 24 * time.Hour
+
+// The format of dates stored by sqlite's datetime function.
+const sqliteDateFormat string = "2006-01-02 15:04:05"
+
+// Session is a login that can be resumed with its token instead of the password.
+type Session struct {
+	Token string		`json:"token"`
+	ExpiresAt string	`json:"expires_at"`
+}
+
+func (s Session) String() string {
+	return s.Token + " " + s.ExpiresAt
+}
+
+// Generates a new random session token.
+func newSessionToken() (string, error) {
+	token := make([]byte, 32)
+	_, err := rand.Read(token)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(token), nil
+}
+
+// Hashes a session token, only the hashes of tokens are stored in the database.
+func hashSessionToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+// Creates a new session for the username and stores it with the addSession statement.
+func (cm *ServerManager) newSession(username string, addSession *sql.Stmt) (Session, error) {
+	token, err := newSessionToken()
+	if err != nil {
+		return Session{}, err
+	}
+	expiresAt := time.Now().UTC().Add(SessionDuration).Format(sqliteDateFormat)
+
+	cm.mu.Lock()
+	_, err = addSession.Exec(hashSessionToken(token), username, expiresAt)
+	cm.mu.Unlock()
+	if err != nil {
+		return Session{}, err
+	}
+
+	return Session{Token: token, ExpiresAt: expiresAt}, nil
+}
@@ -0,0 +1,305 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// The text protocol, requests are a two letter request type followed by space separated arguments.
+const TextProtocol string = "text"
+
+// Escapes backslashes and line breaks in free text, e.g. the content of messages or the names of users and chats set with the JSON protocol.
+// a line break is written as "\n" and a backslash as "\\", so every message takes a single line in the text protocol.
+var textEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, "\r", `\r`)
+
+// Returned when a text request has no request type.
+var ErrEmptyRequest = errors.New("empty request")
+
+// Parses a text request into a client request.
+// A request can start with "#" followed by a request id, e.g. "#12 jo chat password".
+// Also returns the id of the chat the request is for if it is a chat related request.
+func (u *User) parseTextRequest(frame []byte) (ClientRequest, string, error) {
+	message := strings.Fields(strings.TrimSpace(string(frame)))
+
+	var requestId string
+	if len(message) > 0 && strings.HasPrefix(message[0], "#") {
+		requestId = strings.TrimPrefix(message[0], "#")
+		message = message[1:]
+	}
+
+	req, chatId, err := u.parseTextFields(message)
+	req.requestId = requestId
+	return req, chatId, err
+}
+
+// Parses the fields of a text request without the request id.
+func (u *User) parseTextFields(message []string) (ClientRequest, string, error) {
+	argCount := len(message)-1
+	if argCount == -1 {
+		return ClientRequest{}, "", ErrEmptyRequest
+	}
+
+	switch message[0] {
+	case LoginRequestType:
+		if argCount != 2 {
+			return ClientRequest{}, "", badRequest("Error: Unknown username or password")
+		}
+		return LoginRequest(message[1], message[2], u), "", nil
+
+	case NewUserRequestType:
+		if argCount < 3 {
+			return ClientRequest{}, "", badRequest("Error: User data format Error")
+		}
+		return NewUserRequest(message[1], strings.Join(message[2:argCount], " "), message[argCount], u), "", nil
+
+	case QuitRequestType:
+		if argCount != 0 {
+			return ClientRequest{}, "", badRequest("Error: User data format Error")
+		}
+		return QuitRequest(u), "", nil
+
+	case ResumeRequestType:
+		if argCount != 1 {
+			return ClientRequest{}, "", badRequest("Error: Session token is missing")
+		}
+		return ResumeRequest(message[1], u), "", nil
+
+	case LogoutRequestType:
+		if argCount != 0 {
+			return ClientRequest{}, "", badRequest("Error: User data format Error")
+		}
+		return LogoutRequest(u), "", nil
+
+	case DeleteUserRequestType:
+		if argCount != 1 {
+			return ClientRequest{}, "", badRequest("Error: User data format Error")
+		}
+		return DeleteUserRequest(message[1], u), "", nil
+
+	case JoinChatRequestType:
+		if argCount == 1 {
+			return JoinChatRequest(message[1], "", u), "", nil
+		}
+		if argCount != 2 {
+			return ClientRequest{}, "", badRequest("Error: User data format Error")
+		}
+		return JoinChatRequest(message[1], message[2], u), "", nil
+
+	case LeaveChatRequestType:
+		if argCount != 1 {
+			return ClientRequest{}, "", badRequest("Error: User data format Error")
+		}
+		return LeaveChatRequest(message[1], u), "", nil
+
+	case NewChatRequestType:
+		if argCount < 3 {
+			return ClientRequest{}, "", badRequest("Error: User data format Error")
+		}
+		return NewChatRequest(message[1], strings.Join(message[2:argCount], " "), message[argCount], u), "", nil
+
+	case DeleteChatRequestType:
+		if argCount != 2 {
+			return ClientRequest{}, "", badRequest("Error: User data format Error")
+		}
+		return DeleteChatRequest(message[1], message[2], u), "", nil
+
+	case GetChatsRequestType:
+		if argCount != 0 {
+			return ClientRequest{}, "", badRequest("Error: User data format Error")
+		}
+		return GetChatsRequest(u), "", nil
+
+	case SetRoleRequestType:
+		if argCount != 3 || !IsRole(message[3]) {
+			return ClientRequest{}, "", badRequest("Error: Chat ID, username or role is missing or invalid")
+		}
+		return SetRoleRequest(message[1], message[2], message[3], u), "", nil
+
+	case KickRequestType:
+		if argCount != 2 {
+			return ClientRequest{}, "", badRequest("Error: Chat ID or username is missing")
+		}
+		return KickRequest(message[1], message[2], u), "", nil
+
+	case BanRequestType:
+		if argCount < 3 {
+			return ClientRequest{}, "", badRequest("Error: Chat ID, username or duration is missing")
+		}
+		return BanRequest(message[1], message[2], message[3], strings.Join(message[4:], " "), u), "", nil
+
+	case UnbanRequestType:
+		if argCount != 2 {
+			return ClientRequest{}, "", badRequest("Error: Chat ID or username is missing")
+		}
+		return UnbanRequest(message[1], message[2], u), "", nil
+
+	case TransferOwnershipRequestType:
+		if argCount != 2 {
+			return ClientRequest{}, "", badRequest("Error: Chat ID or username is missing")
+		}
+		return TransferOwnershipRequest(message[1], message[2], u), "", nil
+
+	case RenameChatRequestType:
+		if argCount < 2 {
+			return ClientRequest{}, "", badRequest("Error: Chat ID or chat name is missing")
+		}
+		return RenameChatRequest(message[1], strings.Join(message[2:], " "), u), "", nil
+
+	case ChangeChatPasswordRequestType:
+		if argCount != 2 {
+			return ClientRequest{}, "", badRequest("Error: Chat ID or chat password is missing")
+		}
+		return ChangeChatPasswordRequest(message[1], message[2], u), "", nil
+
+	case ChangeNameRequestType:
+		if argCount < 1 {
+			return ClientRequest{}, "", badRequest("Error: Name is missing")
+		}
+		return ChangeNameRequest(strings.Join(message[1:], " "), u), "", nil
+
+	case ChangePasswordRequestType:
+		if argCount != 2 {
+			return ClientRequest{}, "", badRequest("Error: Old or new password is missing")
+		}
+		return ChangePasswordRequest(message[1], message[2], u), "", nil
+
+	case SendDirectRequestType:
+		if argCount < 2 {
+			return ClientRequest{}, "", badRequest("Error: Message is empty or username is missing")
+		}
+		return SendDirectRequest(message[1], strings.Join(message[2:], " "), u), "", nil
+
+	case CreateInviteRequestType:
+		if argCount != 3 {
+			return ClientRequest{}, "", badRequest("Error: Chat ID, max uses or duration is missing")
+		}
+		return CreateInviteRequest(message[1], message[2], message[3], u), "", nil
+
+	case JoinInviteRequestType:
+		if argCount != 1 {
+			return ClientRequest{}, "", badRequest("Error: Invite code is missing")
+		}
+		return JoinInviteRequest(message[1], u), "", nil
+
+	case RevokeInviteRequestType:
+		if argCount != 1 {
+			return ClientRequest{}, "", badRequest("Error: Invite code is missing")
+		}
+		return RevokeInviteRequest(message[1], u), "", nil
+
+	case SetVisibilityRequestType:
+		if argCount != 2 || !IsVisibility(message[2]) {
+			return ClientRequest{}, "", badRequest("Error: Chat ID or visibility is missing or invalid")
+		}
+		return SetVisibilityRequest(message[1], message[2], u), "", nil
+
+	case SearchChatsRequestType:
+		return SearchChatsRequest(strings.Join(message[1:], " "), u), "", nil
+
+	case NewMessageRequestType:
+		if argCount < 2 {
+			return ClientRequest{}, "", badRequest("Error: Message is empty or chat id is missing")
+		}
+		return NewMessageRequest(strings.Join(message[2:], " "), u), message[1], nil
+
+	case ReplyRequestType:
+		if argCount < 3 {
+			return ClientRequest{}, "", badRequest("Error: Message ID, content or chat id is missing")
+		}
+		return ReplyRequest(message[2], strings.Join(message[3:], " "), u), message[1], nil
+
+	case GetThreadRequestType:
+		if argCount != 2 && argCount != 3 {
+			return ClientRequest{}, "", badRequest("Error: Message ID is not present or chat id is missing")
+		}
+		if argCount == 3 {
+			return GetThreadRequest(message[2], message[3], u), message[1], nil
+		}
+		return GetThreadRequest(message[2], "0", u), message[1], nil
+
+	case DeleteMessageRequestType:
+		if argCount < 2 {
+			return ClientRequest{}, "", badRequest("Error: Message ID is not present or chat id is missing")
+		}
+		return DeleteMessageRequest(message[2], u), message[1], nil
+
+	case EditMessageRequestType:
+		if argCount < 3 {
+			return ClientRequest{}, "", badRequest("Error: Message ID, content or chat id is missing")
+		}
+		return EditMessageRequest(message[2], strings.Join(message[3:], " "), u), message[1], nil
+
+	case GetMessagesRequestType:
+		if argCount < 3 {
+			return ClientRequest{}, "", badRequest("Error: Message IDs are not present empty or chat id is missing")
+		}
+		if message[2] == MessagesBeforeMode {
+			if argCount < 4 {
+				return ClientRequest{}, "", badRequest("Error: Message ID or limit is missing")
+			}
+			return GetMessagesBeforeRequest(message[3], message[4], u), message[1], nil
+		}
+		return GetMessagesRequest(message[2], message[3], u), message[1], nil
+
+	case GetUsersRequestType:
+		if argCount < 1 {
+			return ClientRequest{}, "", badRequest("Error:Chat ID is missing")
+		}
+		return GetUsersRequest(u), message[1], nil
+
+	case MarkReadRequestType:
+		if argCount != 2 {
+			return ClientRequest{}, "", badRequest("Error: Message ID is not present or chat id is missing")
+		}
+		return MarkReadRequest(message[2], u), message[1], nil
+
+	case AddReactionRequestType, RemoveReactionRequestType:
+		if argCount != 3 || !IsValidEmoji(message[3]) {
+			return ClientRequest{}, "", badRequest("Error: Message ID, emoji or chat id is missing or invalid")
+		}
+		if message[0] == AddReactionRequestType {
+			return AddReactionRequest(message[2], message[3], u), message[1], nil
+		}
+		return RemoveReactionRequest(message[2], message[3], u), message[1], nil
+
+	case PinMessageRequestType, UnpinMessageRequestType:
+		if argCount != 2 {
+			return ClientRequest{}, "", badRequest("Error: Message ID is not present or chat id is missing")
+		}
+		if message[0] == PinMessageRequestType {
+			return PinMessageRequest(message[2], u), message[1], nil
+		}
+		return UnpinMessageRequest(message[2], u), message[1], nil
+
+	case GetPinsRequestType:
+		if argCount != 1 && argCount != 2 {
+			return ClientRequest{}, "", badRequest("Error: Chat ID is missing")
+		}
+		if argCount == 2 {
+			return GetPinsRequest(message[2], u), message[1], nil
+		}
+		return GetPinsRequest("0", u), message[1], nil
+	}
+
+	return ClientRequest{}, "", CodedError{Code: ErrorCodeUnknownRequest, Text: "Error: Unknown request " + message[0]}
+}
+
+// Encodes a message as its type followed by its content.
+// if the message is a reply, the request id is put after the type, e.g. "a #12 Joined chat".
+// if the message is an error, the error code is put before the content, e.g. "e #12 CHAT_NOT_FOUND No Such Chat".
+// if the message has data, the data is put on the lines after the content.
+func encodeTextMessage(mes Message) []byte {
+	message := mes.string
+	if mes.requestId != "" {
+		message += " #" + mes.requestId
+	}
+	if mes.code != "" {
+		message += " " + mes.code
+	}
+	message += " " + textEscaper.Replace(mes.content)
+	if data, ok := mes.data.(fmt.Stringer); ok && data.String() != "" {
+		message += "\n" + data.String()
+	}
+	return []byte(message)
+}
@@ -0,0 +1,232 @@
+package server
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Gets the error code of an error returned by a parser, or an empty string if the error is nil.
+func errorCode(err error) string {
+	if err == nil {
+		return ""
+	}
+	var codedErr CodedError
+	if errors.As(err, &codedErr) {
+		return codedErr.Code
+	}
+	return err.Error()
+}
+
+func TestParseTextFields(t *testing.T) {
+	tests := []struct {
+		request string
+		wantType string		// the expected type of the request, empty if an error is expected.
+		wantArgs []string	// the expected arguments, not checked if nil.
+		wantChatId string
+		wantCode string		// the expected error code, empty if no error is expected.
+	}{
+		{"li alice secret", LoginRequestType, []string{"alice", "secret"}, "", ""},
+		{"li alice", "", nil, "", ErrorCodeBadRequest},
+		{"li alice secret extra", "", nil, "", ErrorCodeBadRequest},
+
+		{"nu alice Alice Smith secret", NewUserRequestType, []string{"alice", "Alice Smith", "secret"}, "", ""},
+		{"nu alice secret", "", nil, "", ErrorCodeBadRequest},
+
+		{"qu", QuitRequestType, nil, "", ""},
+		{"qu now", "", nil, "", ErrorCodeBadRequest},
+
+		{"rs token", ResumeRequestType, []string{"token"}, "", ""},
+		{"rs", "", nil, "", ErrorCodeBadRequest},
+		{"rs token extra", "", nil, "", ErrorCodeBadRequest},
+
+		{"lo", LogoutRequestType, nil, "", ""},
+		{"lo now", "", nil, "", ErrorCodeBadRequest},
+
+		{"du secret", DeleteUserRequestType, []string{"secret"}, "", ""},
+		{"du", "", nil, "", ErrorCodeBadRequest},
+		{"du secret extra", "", nil, "", ErrorCodeBadRequest},
+
+		{"jo room", JoinChatRequestType, []string{"room", ""}, "", ""},
+		{"jo room secret", JoinChatRequestType, []string{"room", "secret"}, "", ""},
+		{"jo", "", nil, "", ErrorCodeBadRequest},
+		{"jo room secret extra", "", nil, "", ErrorCodeBadRequest},
+
+		{"le room", LeaveChatRequestType, []string{"room"}, "", ""},
+		{"le", "", nil, "", ErrorCodeBadRequest},
+		{"le room extra", "", nil, "", ErrorCodeBadRequest},
+
+		{"nc room The Room secret", NewChatRequestType, []string{"room", "The Room", "secret"}, "", ""},
+		{"nc room secret", "", nil, "", ErrorCodeBadRequest},
+
+		{"dc room secret", DeleteChatRequestType, []string{"room", "secret"}, "", ""},
+		{"dc room", "", nil, "", ErrorCodeBadRequest},
+		{"dc room secret extra", "", nil, "", ErrorCodeBadRequest},
+
+		{"gc", GetChatsRequestType, nil, "", ""},
+		{"gc room", "", nil, "", ErrorCodeBadRequest},
+
+		{"sr room bob admin", SetRoleRequestType, []string{"room", "bob", "admin"}, "", ""},
+		{"sr room bob", "", nil, "", ErrorCodeBadRequest},
+		{"sr room bob king", "", nil, "", ErrorCodeBadRequest},
+
+		{"ki room bob", KickRequestType, []string{"room", "bob"}, "", ""},
+		{"ki room", "", nil, "", ErrorCodeBadRequest},
+		{"ki room bob extra", "", nil, "", ErrorCodeBadRequest},
+
+		{"ba room bob 24h spamming links", BanRequestType, []string{"room", "bob", "24h", "spamming links"}, "", ""},
+		{"ba room bob forever", BanRequestType, []string{"room", "bob", "forever", ""}, "", ""},
+		{"ba room bob", "", nil, "", ErrorCodeBadRequest},
+
+		{"ub room bob", UnbanRequestType, []string{"room", "bob"}, "", ""},
+		{"ub room", "", nil, "", ErrorCodeBadRequest},
+		{"ub room bob extra", "", nil, "", ErrorCodeBadRequest},
+
+		{"to room bob", TransferOwnershipRequestType, []string{"room", "bob"}, "", ""},
+		{"to room", "", nil, "", ErrorCodeBadRequest},
+		{"to room bob extra", "", nil, "", ErrorCodeBadRequest},
+
+		{"rn room New Name", RenameChatRequestType, []string{"room", "New Name"}, "", ""},
+		{"rn room", "", nil, "", ErrorCodeBadRequest},
+
+		{"cp room secret", ChangeChatPasswordRequestType, []string{"room", "secret"}, "", ""},
+		{"cp room", "", nil, "", ErrorCodeBadRequest},
+		{"cp room secret extra", "", nil, "", ErrorCodeBadRequest},
+
+		{"cn Alice Smith", ChangeNameRequestType, []string{"Alice Smith"}, "", ""},
+		{"cn", "", nil, "", ErrorCodeBadRequest},
+
+		{"pw old new", ChangePasswordRequestType, []string{"old", "new"}, "", ""},
+		{"pw old", "", nil, "", ErrorCodeBadRequest},
+		{"pw old new extra", "", nil, "", ErrorCodeBadRequest},
+
+		{"sd bob hello there", SendDirectRequestType, []string{"bob", "hello there"}, "", ""},
+		{"sd bob", "", nil, "", ErrorCodeBadRequest},
+
+		{"ci room 5 24h", CreateInviteRequestType, []string{"room", "5", "24h"}, "", ""},
+		{"ci room 5", "", nil, "", ErrorCodeBadRequest},
+		{"ci room 5 24h extra", "", nil, "", ErrorCodeBadRequest},
+
+		{"ji code", JoinInviteRequestType, []string{"code"}, "", ""},
+		{"ji", "", nil, "", ErrorCodeBadRequest},
+		{"ji code extra", "", nil, "", ErrorCodeBadRequest},
+
+		{"ri code", RevokeInviteRequestType, []string{"code"}, "", ""},
+		{"ri", "", nil, "", ErrorCodeBadRequest},
+		{"ri code extra", "", nil, "", ErrorCodeBadRequest},
+
+		{"sv room public", SetVisibilityRequestType, []string{"room", "public"}, "", ""},
+		{"sv room", "", nil, "", ErrorCodeBadRequest},
+		{"sv room hidden", "", nil, "", ErrorCodeBadRequest},
+
+		{"sc", SearchChatsRequestType, []string{""}, "", ""},
+		{"sc go lang", SearchChatsRequestType, []string{"go lang"}, "", ""},
+
+		{"nm room hello there", NewMessageRequestType, nil, "room", ""},
+		{"nm room", "", nil, "", ErrorCodeBadRequest},
+
+		{"rp room 3 hello there", ReplyRequestType, nil, "room", ""},
+		{"rp room 3", "", nil, "", ErrorCodeBadRequest},
+
+		{"gt room 3", GetThreadRequestType, []string{"3", "0"}, "room", ""},
+		{"gt room 3 7", GetThreadRequestType, []string{"3", "7"}, "room", ""},
+		{"gt room", "", nil, "", ErrorCodeBadRequest},
+		{"gt room 3 7 extra", "", nil, "", ErrorCodeBadRequest},
+
+		{"dm room 3", DeleteMessageRequestType, nil, "room", ""},
+		{"dm room", "", nil, "", ErrorCodeBadRequest},
+
+		{"em room 3 new content", EditMessageRequestType, nil, "room", ""},
+		{"em room 3", "", nil, "", ErrorCodeBadRequest},
+
+		{"gm room 1 10", GetMessagesRequestType, nil, "room", ""},
+		{"gm room before 0 20", GetMessagesRequestType, nil, "room", ""},
+		{"gm room 1", "", nil, "", ErrorCodeBadRequest},
+		{"gm room before 0", "", nil, "", ErrorCodeBadRequest},
+
+		{"gu room", GetUsersRequestType, nil, "room", ""},
+		{"gu", "", nil, "", ErrorCodeBadRequest},
+
+		{"mr room 3", MarkReadRequestType, nil, "room", ""},
+		{"mr room", "", nil, "", ErrorCodeBadRequest},
+		{"mr room 3 extra", "", nil, "", ErrorCodeBadRequest},
+
+		{"ar room 3 👍", AddReactionRequestType, nil, "room", ""},
+		{"ar room 3", "", nil, "", ErrorCodeBadRequest},
+		{"ar room 3 👍 extra", "", nil, "", ErrorCodeBadRequest},
+		{"ar room 3 " + strings.Repeat("a", MaxEmojiSize + 1), "", nil, "", ErrorCodeBadRequest},
+		{"rr room 3 👍", RemoveReactionRequestType, nil, "room", ""},
+		{"rr room 3", "", nil, "", ErrorCodeBadRequest},
+
+		{"pi room 3", PinMessageRequestType, nil, "room", ""},
+		{"pi room", "", nil, "", ErrorCodeBadRequest},
+		{"up room 3", UnpinMessageRequestType, nil, "room", ""},
+		{"up room 3 extra", "", nil, "", ErrorCodeBadRequest},
+
+		{"lp room", GetPinsRequestType, []string{"0"}, "room", ""},
+		{"lp room 7", GetPinsRequestType, []string{"7"}, "room", ""},
+		{"lp", "", nil, "", ErrorCodeBadRequest},
+		{"lp room 7 extra", "", nil, "", ErrorCodeBadRequest},
+
+		{"xx room", "", nil, "", ErrorCodeUnknownRequest},
+		{ConnectRequestType + " alice", "", nil, "", ErrorCodeUnknownRequest},
+		{DisconnectRequestType + " alice", "", nil, "", ErrorCodeUnknownRequest},
+		{BroadcastRequestType, "", nil, "", ErrorCodeUnknownRequest},
+	}
+	user := &User{}
+	for _, test := range tests {
+		t.Run(test.request, func(t *testing.T) {
+			req, chatId, err := user.parseTextFields(strings.Fields(test.request))
+			if code := errorCode(err); code != test.wantCode {
+				t.Fatalf("got error %v, want code %q", err, test.wantCode)
+			}
+			if test.wantCode != "" {
+				return
+			}
+			if req.string != test.wantType {
+				t.Errorf("got type %q, want %q", req.string, test.wantType)
+			}
+			if chatId != test.wantChatId {
+				t.Errorf("got chat id %q, want %q", chatId, test.wantChatId)
+			}
+			if test.wantArgs != nil && !reflect.DeepEqual(req.args, test.wantArgs) {
+				t.Errorf("got args %q, want %q", req.args, test.wantArgs)
+			}
+			if req.sender != user {
+				t.Errorf("the sender of the request is not the user")
+			}
+		})
+	}
+}
+
+func TestParseTextRequest(t *testing.T) {
+	user := &User{}
+
+	req, _, err := user.parseTextRequest([]byte("  #12 jo room secret \n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if req.requestId != "12" || req.string != JoinChatRequestType {
+		t.Errorf("got request id %q and type %q, want \"12\" and %q", req.requestId, req.string, JoinChatRequestType)
+	}
+
+	_, _, err = user.parseTextRequest([]byte("   "))
+	if !errors.Is(err, ErrEmptyRequest) {
+		t.Errorf("got %v for an empty request, want ErrEmptyRequest", err)
+	}
+
+	_, _, err = user.parseTextRequest([]byte("#12"))
+	if !errors.Is(err, ErrEmptyRequest) {
+		t.Errorf("got %v for a request with only an id, want ErrEmptyRequest", err)
+	}
+}
+
+func TestTextEscapesFreeText(t *testing.T) {
+	if got, want := (NameChange{Username: "alice", Name: "Alice\na 1 x"}).String(), `alice Alice\na 1 x`; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got, want := string(encodeTextMessage(NewMessage("n", "line 1\r\nline 2"))), `n line 1\r\nline 2`; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
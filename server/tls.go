@@ -0,0 +1,103 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"net"
+	"os"
+	"time"
+)
+
+// How long a generated self signed certificate is valid for.
+const SelfSignedCertValidFor time.Duration = 365 * 24 * time.Hour
+
+// Creates the TLS config of the server from a certificate and key files.
+// if clientCAFile is not empty, clients must send a certificate signed by one of the CAs in the file.
+func LoadTLSConfig(certFile string, keyFile string, clientCAFile string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	return newTLSConfig(cert, clientCAFile)
+}
+
+// Creates the TLS config of the server with a generated self signed certificate.
+// it is meant for development only, clients have to skip verifying the certificate or trust it explicitly.
+func SelfSignedTLSConfig(hosts []string, clientCAFile string) (*tls.Config, error) {
+	cert, err := GenerateSelfSignedCert(hosts)
+	if err != nil {
+		return nil, err
+	}
+	return newTLSConfig(cert, clientCAFile)
+}
+
+func newTLSConfig(cert tls.Certificate, clientCAFile string) (*tls.Config, error) {
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion: tls.VersionTLS12,
+	}
+
+	if clientCAFile != "" {
+		pem, err := os.ReadFile(clientCAFile)
+		if err != nil {
+			return nil, err
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("no certificates found in " + clientCAFile)
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return config, nil
+}
+
+// Generates a self signed certificate for the hosts, a host can be a DNS name or an IP address.
+func GenerateSelfSignedCert(hosts []string) (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	now := time.Now()
+	template := x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{Organization: []string{"sdig development"}},
+		NotBefore: now,
+		NotAfter: now.Add(SelfSignedCertValidFor),
+		KeyUsage: x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	return tls.Certificate{
+		Certificate: [][]byte{der},
+		PrivateKey: key,
+	}, nil
+}
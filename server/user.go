@@ -1,17 +1,27 @@
 package server
 
 import (
+	"bufio"
+	"errors"
 	"log"
 	"net"
-	"strings"
+	"sync"
 )
 
 // Message is a message by a chat or the server manager to a client.
 type Message struct {
 	// The string is the type of the message.
-	// The types are for now ("n" for "notify" and "e" for "error")
+	// The types are for now:
+	//	"a": "ack", the request succeeded.
+	//	"n": "notify"
+	//	"e": "error"
+	//	"m": a new message in a chat.
+	//	"v": an event in a chat, e.g. a message got deleted.
 	string
-	content string 	// the content of the message.
+	requestId string	// the id of the request this message is a reply to, empty if it is not a reply.
+	code string			// the error code of an error message, empty if it is not an error.
+	content string 		// the content of the message.
+	data any			// structured data of the message, e.g. a session or a list of messages, can be nil.
 }
 
 // Create a new Message.
@@ -22,184 +32,283 @@ func NewMessage(message string, content string) Message {
 	}
 }
 
+// Create a new Message that carries structured data.
+// the data is sent as a JSON object in the JSON protocol and with its String method in the text protocol.
+func NewDataMessage(message string, content string, data any) Message {
+	return Message{
+		string: message,
+		content: content,
+		data: data,
+	}
+}
+
+// Create a new error Message with one of the error codes.
+func NewErrorMessage(code string, content string) Message {
+	return Message{
+		string: "e",
+		code: code,
+		content: content,
+	}
+}
+
+// Create a new error Message from an error, the error code is taken from the error if it is a CodedError.
+func errorToMessage(err error) Message {
+	var codedErr CodedError
+	if errors.As(err, &codedErr) {
+		return NewErrorMessage(codedErr.Code, codedErr.Text)
+	}
+	return NewErrorMessage(ErrorCodeInternal, err.Error())
+}
+
 
 // This type contains information about the client.
 // The information is the following:
 //	username: a unique name to each user.
 // 	name: a nickname of sort, it doesn't have to be unique.
 // 	conn: the socket.
+// 	reader: a buffered reader of the socket that frames are read from.
+// 	protocol: the protocol the client speaks, it is chosen by the first frame the client sends.
 // 	chats: a map of strings that represents a unique id to a channel of the chat of that id.
+// 	mu: a mutex that guards chats, they are changed by the user, the server manager and chats.
 // 	serverChan: the channel of the server manager.
 // 	messages: a channel of messages to be sent to the client.
+// 	done: a channel that is closed when the client quits, sends to a user that quit are dropped.
 // 	connected: a bool that represents whether a client has logged in to a user.
+// 	token: the token of the session of the user, empty if the user is not logged in.
 type User struct {
 	username string						// a unique name to each user
 	name string							// a nickname of sort, it doesn't have to be unique.
 	conn net.Conn						// the socket of the client.
+	reader *bufio.Reader				// a buffered reader of the socket that frames are read from.
+	protocol string						// the protocol the client speaks, it is chosen by the first frame the client sends.
 	chats map[string]chan ClientRequest	// a map of strings that represents a unique id to a channel of the chat of that id.
+	mu *sync.Mutex						// a mutex that guards chats.
 	serverChan chan ClientRequest		// the chanel of the server manager.
 	messages chan Message				// a chanel of messages to be sent to the client.
+	done chan struct{}					// a chanel that is closed when the client quits.
 	connected bool						// a bool that represents whether a client has logged in to a user.
+	token string						// the token of the session of the user, empty if the user is not logged in.
 }
 
 // Initializes a new user that isn't logged in to any account.
 func NewUser(conn net.Conn, serverChan chan ClientRequest) User {
 	return User {
 		conn: conn,
+		reader: bufio.NewReader(conn),
 		serverChan: serverChan,
 		chats: make(map[string]chan ClientRequest),
+		mu: &sync.Mutex{},
 		messages: make(chan Message),
+		done: make(chan struct{}),
 		connected: false,
 	}
 }
 
 // Handles and procceses requests sent by the user throgh the socket and sends the proccesed request to a chat or to the server manager.
+// The first frame sent by the client chooses the protocol, a JSON hello chooses the JSON protocol and anything else chooses the text protocol.
 func (u *User) HandleUserRequest() {
 	for {
-		var buffer []byte = make([]byte, 1024)
-		n, err := u.conn.Read(buffer)
-		if err != nil {
+		frame, err := ReadFrame(u.reader)
+		if errors.Is(err, ErrFrameTooLarge) {
+			u.disconnect(NewErrorMessage(ErrorCodeRequestTooLarge, "Error: Request is too large"))
+			u.quit()
+			return
+		} else if err != nil {
 			log.Println("ERROR: Failed to read from user:", err)
+			u.quit()
+			return
 		}
-		message := strings.Fields(strings.TrimSpace(string(buffer[0:n])))
-		argCount := len(message)-1
-		if argCount == -1 {
-			continue;
-		}
-
-		if u.connected == false {
-			switch message[0] {
-			case LoginRequestType:
-				if argCount != 2 {
-					u.messages <- NewMessage("e", "Error: Unknown username or password")
-					continue
-				}
-				username, password := message[1], message[2]
-				u.serverChan <- LoginRequest(username, password, u)
-
-			case NewUserRequestType:
-				if argCount < 3 {
-					u.messages <- NewMessage("e", "Error: User data format Error")
-					continue
-				}
-				u.serverChan <- NewUserRequest(message[1], strings.Join(message[2:argCount], " "), message[argCount], u)
 
-			case QuitRequestType:
-				if argCount != 0 {
-					u.messages <- NewMessage("e", "Error: User data format Error")
-					continue
+		if u.protocol == "" {
+			if isJsonHello(frame) {
+				err := u.jsonHandshake(frame)
+				if err != nil {
+					u.send(errorToMessage(err))
 				}
-				for _, chat := range u.chats {
-					chat <- QuitRequest(u)
-				}
-				u.messages <- NewMessage("q", "quitting")
-				u.conn.Close()
-				return
+				continue
 			}
+			u.protocol = TextProtocol
+		}
+
+		var req ClientRequest
+		var chatId string
+		if u.protocol == JsonProtocol {
+			req, chatId, err = u.parseJsonRequest(frame)
 		} else {
-			switch message[0] {
-			case LogoutRequestType:
-				if argCount != 0 {
-					u.messages <- NewMessage("e", "Error: User data format Error")
-					continue
-				}
-				for _, chat := range u.chats {
-					chat <- LogoutRequest(u)
-				}
-				u.connected = false
-				u.chats =  make(map[string]chan ClientRequest)
-				u.messages <- NewMessage("n", "logged out")
-
-			case DeleteUserRequestType:
-				if argCount != 1 {
-					u.messages <- NewMessage("e", "Error: User data format Error")
-					continue
-				}
-				u.serverChan <- DeleteUserRequest(message[1], u)
+			req, chatId, err = u.parseTextRequest(frame)
+		}
+		if errors.Is(err, ErrEmptyRequest) {
+			continue
+		} else if err != nil {
+			reply := errorToMessage(err)
+			reply.requestId = req.requestId
+			u.send(reply)
+			continue
+		}
 
-			case JoinChatRequestType:
-				if argCount != 2 {
-					u.messages <- NewMessage("e", "Error: User data format Error")
-					continue
-				}
-				u.serverChan <- JoinChatRequest(message[1], message[2], u)
+		if u.handleRequest(req, chatId) {
+			return
+		}
+	}
+}
 
-			case LeaveChatRequestType:
-				if argCount != 1 {
-					u.messages <- NewMessage("e", "Error: User data format Error")
-					continue
-				}
-				u.serverChan <- LeaveChatRequest(message[1], u)
+// Sends a parsed request to the chat it belongs to or to the server manager.
+// Returns true if the user has quit.
+func (u *User) handleRequest(req ClientRequest, chatId string) bool {
+	if u.connected == false {
+		switch req.string {
+		case LoginRequestType, NewUserRequestType, ResumeRequestType, QuitRequestType:
+		default:
+			u.send(req.Error(ErrorCodeNotLoggedIn, "Error: Not logged in"))
+			return false
+		}
+	} else {
+		switch req.string {
+		case LoginRequestType, NewUserRequestType, ResumeRequestType:
+			u.send(req.Error(ErrorCodeAlreadyLoggedIn, "Error: Already logged in"))
+			return false
+		}
+	}
 
-			case NewChatRequestType:
-				if argCount < 3 {
-					u.messages <- NewMessage("e", "Error: User data format Error")
-					continue
-				}
-				u.serverChan <- NewChatRequest(message[1], strings.Join(message[2:argCount], " "), message[argCount], u)
+	switch req.string {
+	case QuitRequestType:
+		u.quit()
+		return true
 
-			case DeleteChatRequestType:
-				if argCount != 2 {
-					u.messages <- NewMessage("e", "Error: User data format Error")
-					continue
-				}
-				u.serverChan <- DeleteChatRequest(message[1], message[2], u)
+	case LogoutRequestType:
+		for _, chat := range u.removeChats() {
+			chat <- req
+		}
+		u.serverChan <- req
+		u.connected = false
+		u.token = ""
+		u.send(req.Reply("a", "logged out"))
 
-			case QuitRequestType:
-				if argCount != 0 {
-					u.messages <- NewMessage("e", "Error: User data format Error")
-					continue
-				}
-				for _, chat := range u.chats {
-					chat <- QuitRequest(u)
-				}
-				u.messages <- NewMessage("q", "quitting")
-				u.conn.Close()
-				return
-
-			case NewMessageRequestType:
-				if argCount < 2 {
-					u.messages <- NewMessage("e", "Error: Message is empty or chat id is missing")
-					continue
-				}
-				chatId, content := message[1] ,strings.Join(message[2:], " ")
-				u.chats[chatId] <- NewMessageRequest(content, u)
+	case NewMessageRequestType, ReplyRequestType, DeleteMessageRequestType, EditMessageRequestType, GetMessagesRequestType, GetThreadRequestType, GetUsersRequestType, MarkReadRequestType, AddReactionRequestType, RemoveReactionRequestType, PinMessageRequestType, UnpinMessageRequestType, GetPinsRequestType:
+		chat, ok := u.chat(chatId)
+		if !ok {
+			u.send(req.Error(ErrorCodeNotJoined, "Error: Not a member of " + chatId))
+			return false
+		}
+		chat <- req
 
-			case DeleteMessageRequestType:
-				if argCount < 2 {
-					u.messages <- NewMessage("e", "Error: Message ID is not present or chat id is missing")
-					continue
-				}
-				u.chats[message[1]] <- DeleteMessageRequest(message[2], u)
+	default:
+		u.serverChan <- req
+	}
+	return false
+}
 
-			case GetMessagesRequestType:
-				if argCount < 3 {
-					u.messages <- NewMessage("e", "Error: Message IDs are not present empty or chat id is missing")
-					continue
-				}
-				u.chats[message[1]] <- GetMessagesRequest(message[2], message[3], u)
+// Removes the user from the chats it is connected to and closes the connection.
+func (u *User) quit() {
+	for _, chat := range u.removeChats() {
+		chat <- QuitRequest(u)
+	}
+	if u.connected {
+		u.serverChan <- QuitRequest(u)
+	}
+	close(u.done)
+	u.conn.Close()
+}
 
-			case GetUsersRequestType:
-				if argCount < 1 {
-					u.messages <- NewMessage("e", "Error:Chat ID is missing")
-					continue
-				}
-				u.chats[message[1]] <- GetUsersRequest(u)
-			}
-		}
+// Adds the channel of a chat to the chats of the user.
+func (u *User) addChat(chatId string, chat chan ClientRequest) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.chats[chatId] = chat
+}
+
+// Removes a chat from the chats of the user.
+func (u *User) removeChat(chatId string) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	delete(u.chats, chatId)
+}
+
+// Returns the channel of a chat of the user and whether the user is connected to the chat.
+func (u *User) chat(chatId string) (chan ClientRequest, bool) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	chat, ok := u.chats[chatId]
+	return chat, ok
+}
+
+// Returns the ids of the chats of the user.
+func (u *User) chatIds() []string {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	chatIds := make([]string, 0, len(u.chats))
+	for chatId := range u.chats {
+		chatIds = append(chatIds, chatId)
+	}
+	return chatIds
+}
+
+// Removes all of the chats of the user and returns them.
+func (u *User) removeChats() map[string]chan ClientRequest {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	chats := u.chats
+	u.chats = make(map[string]chan ClientRequest)
+	return chats
+}
+
+// The type of the internal message that tells the writer of the user to close the connection, the messages before it are written first.
+const closeMessageType string = "close"
+
+// Sends the message to the client and then closes the connection, the reader of the user then fails and the user quits.
+func (u *User) disconnect(message Message) {
+	u.send(message)
+	u.send(NewMessage(closeMessageType, ""))
+}
+
+// Sends a message to the client.
+// the message is dropped if the client already quit, so a chat or the server manager never blocks on a client that is gone.
+func (u *User) send(mes Message) {
+	select {
+	case u.messages <- mes:
+	case <-u.done:
+	}
+}
+
+// Checks whether the user has quit.
+func (u *User) hasQuit() bool {
+	select {
+	case <-u.done:
+		return true
+	default:
+		return false
 	}
 }
 
 // Handles messages from the server manager or from other chats.
+// each message is written to the socket as a single frame encoded with the protocol of the user.
 func (u *User) HandleMessagesToUser() {
 	for {
-		mes := <- u.messages
-		mesType := mes.string
-		content := mes.content
-		if mesType == "q" {
-			break
+		var mes Message
+		select {
+		case mes = <-u.messages:
+		case <-u.done:
+			return
+		}
+		if mes.string == closeMessageType {
+			u.conn.Close()
+			continue
 		}
-		message := mesType + " " +  content
-		u.conn.Write([]byte(message))
+		err := WriteFrame(u.conn, u.encodeMessage(mes))
+		if errors.Is(err, ErrFrameTooLarge) {
+			tooLarge := NewErrorMessage(ErrorCodeMessageTooLarge, "Error: Message is too large")
+			tooLarge.requestId = mes.requestId
+			WriteFrame(u.conn, u.encodeMessage(tooLarge))
+		} else if err != nil {
+			log.Println("ERROR: Failed to write to user:", err)
+		}
+	}
+}
+
+// Encodes a message with the protocol of the user.
+func (u *User) encodeMessage(mes Message) []byte {
+	if u.protocol == JsonProtocol {
+		return encodeJsonMessage(mes)
 	}
+	return encodeTextMessage(mes)
 }
@@ -0,0 +1,26 @@
+package server
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestSendAfterQuitDoesNotBlock(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+	user := NewUser(server, make(chan ClientRequest, 1))
+	go user.HandleMessagesToUser()
+	user.quit()
+
+	sent := make(chan struct{})
+	go func() {
+		user.send(NewMessage("n", "after quit"))
+		close(sent)
+	}()
+	select {
+	case <-sent:
+	case <-time.After(time.Second):
+		t.Fatal("send blocked after the user quit")
+	}
+}